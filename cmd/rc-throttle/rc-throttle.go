@@ -9,6 +9,7 @@ import (
 	"go.uber.org/zap"
 	"log"
 	"os"
+	"time"
 )
 
 const (
@@ -19,17 +20,61 @@ const (
 func main() {
 	var mqttBroker, username, password, clientId string
 	var throttleTopic, driveModeTopic, rcThrottleTopic, steeringTopic, throttleFeedbackTopic, maxThrottleCtrlTopic,
-		speedZoneTopic string
+		speedZoneTopic, roadTopic, objectsTopic, lapTopic, raceStartTopic, odometryTopic,
+		statusTopic, eStopTopic string
 	var minThrottle, maxThrottle float64
 	var publishPilotFrequency int
 	var brakeConfig string
 	var enableBrake bool
+	var brakeMode string
+	var configFileBrakePulse string
+	var configFileBrakeSpeed string
+	var escProfile string
+	var configFileSlewLimiter string
+	var brakeFeedbackTimeout time.Duration
+	var brakeDegradedMode string
+	var brakeDegradedMaxThrottle float64
+	var escNeutralDuration time.Duration
 	var acceleratorFactor float64
 	var enableSpeedZone bool
 	var enableCustomSteeringProcessor bool
 	var configFileSteeringProcessor string
+	var enablePIDProcessor bool
+	var configFilePipelineProcessor string
+	var configFileScriptProcessor string
+	var configFilePIDProcessor string
+	var enableRoadProcessor bool
+	var configFileRoadProcessor string
+	var enableAnticipatoryProcessor bool
+	var enableLapLearning bool
+	var configFileLapLearning string
+	var configFileRaceStart string
+	var copilotStrategy string
+	var enableDeadMan bool
+	var deadManThreshold, deadManReleaseThrottle float64
+	var deadManTimeout time.Duration
+	var steeringTimeout time.Duration
+	var steeringTimestamp, steeringFailsafe string
+	var steeringFailsafeThrottle float64
+	var enableSafeTransitions bool
+	var pilotExitThrottle, invalidModeThrottle float64
+	var pilotSoftStart, transitionHoldDuration time.Duration
+	var eStopBrakeThrottle float64
+	var eStopBrakeDuration time.Duration
+	var eStopResetToken string
+	var copilotBlendWeight float64
+	var enableACC bool
+	var configFileACC string
+	var enableSpeedBump bool
+	var configFileConfidenceCurve string
+	var configFileSpeedBump string
+	var configFileAnticipatoryProcessor string
+	var configFileSpeedZone string
 	var slowZoneThrottle, normalZoneThrottle, fastZoneThrottle float64
 	var moderateSteering, fullSteering float64
+	var speedZoneUpgradeMessages, speedZoneDowngradeMessages int
+	var speedZoneUpgradeDwell, speedZoneDowngradeDwell time.Duration
+	var speedZoneRampRate float64
 
 	err := cli.SetFloat64DefaultValueFromEnv(&minThrottle, "THROTTLE_MIN", DefaultThrottleMin)
 	if err != nil {
@@ -52,25 +97,97 @@ func main() {
 	flag.StringVar(&steeringTopic, "mqtt-topic-steering", os.Getenv("MQTT_TOPIC_STEERING"), "Mqtt topic that contains steering value, use MQTT_TOPIC_STEERING if args not set")
 	flag.StringVar(&throttleFeedbackTopic, "mqtt-topic-throttle-feedback", os.Getenv("MQTT_TOPIC_THROTTLE_FEEDBACK"), "Mqtt topic where to publish throttle feedback, use MQTT_TOPIC_THROTTLE_FEEDBACK if args not set")
 	flag.StringVar(&speedZoneTopic, "mqtt-topic-speed-zone", os.Getenv("MQTT_TOPIC_SPEED_ZONE"), "Mqtt topic where to subscribe speed zone events, use MQTT_TOPIC_SPEED_ZONE if args not set")
+	flag.StringVar(&objectsTopic, "mqtt-topic-objects", os.Getenv("MQTT_TOPIC_OBJECTS"), "Mqtt topic where to subscribe detected objects, use MQTT_TOPIC_OBJECTS if args not set")
+	flag.StringVar(&lapTopic, "mqtt-topic-lap", os.Getenv("MQTT_TOPIC_LAP"), "Mqtt topic where to subscribe lap line events, use MQTT_TOPIC_LAP if args not set")
+	flag.StringVar(&raceStartTopic, "mqtt-topic-race-start", os.Getenv("MQTT_TOPIC_RACE_START"), "Mqtt topic where to subscribe race start signal, use MQTT_TOPIC_RACE_START if args not set")
+	flag.StringVar(&odometryTopic, "mqtt-topic-odometry", os.Getenv("MQTT_TOPIC_ODOMETRY"), "Mqtt topic where to subscribe measured speed, use MQTT_TOPIC_ODOMETRY if args not set")
+	flag.StringVar(&statusTopic, "mqtt-topic-status", os.Getenv("MQTT_TOPIC_STATUS"), "Mqtt topic where to publish safety status events, use MQTT_TOPIC_STATUS if args not set")
+	flag.StringVar(&eStopTopic, "mqtt-topic-estop", os.Getenv("MQTT_TOPIC_ESTOP"), "Mqtt topic where to subscribe emergency stop, use MQTT_TOPIC_ESTOP if args not set")
+	flag.StringVar(&roadTopic, "mqtt-topic-road", os.Getenv("MQTT_TOPIC_ROAD"), "Mqtt topic where to subscribe road events, use MQTT_TOPIC_ROAD if args not set")
 
 	flag.Float64Var(&minThrottle, "throttle-min", minThrottle, "Minimum throttle value, use THROTTLE_MIN if args not set")
 	flag.Float64Var(&maxThrottle, "throttle-max", maxThrottle, "Minimum throttle value, use THROTTLE_MAX if args not set")
 	flag.IntVar(&publishPilotFrequency, "update-pwm-frequency", 2, "Number of throttle event to publish when pilot mode is enabled")
 
+	flag.StringVar(&copilotStrategy, "copilot-strategy", string(throttle.CopilotRC), "Strategy to combine rc and processor throttle on copilot mode: rc, cap, blend or brake (needs --enable-brake-feature)")
+	flag.Float64Var(&copilotBlendWeight, "copilot-blend-weight", 0.5, "Weight of processor throttle when --copilot-strategy is 'blend'")
+
+	flag.BoolVar(&enableDeadMan, "enable-dead-man", false, "On pilot mode, publish autopilot throttle only while rc throttle is held")
+	flag.Float64Var(&deadManThreshold, "dead-man-threshold", 0.2, "Min rc throttle to consider dead-man trigger as held")
+	flag.DurationVar(&deadManTimeout, "dead-man-timeout", 500*time.Millisecond, "Release autopilot throttle if no rc throttle is received since this duration")
+	flag.Float64Var(&deadManReleaseThrottle, "dead-man-release-throttle", 0., "Throttle to publish when dead-man trigger is released, 0 for neutral or negative value to brake")
+
+	flag.DurationVar(&steeringTimeout, "steering-timeout", 0, "Publish failsafe throttle on PILOT mode when no steering is received since this duration, disabled if 0")
+	flag.StringVar(&steeringTimestamp, "steering-timestamp", string(throttle.SteeringTimestampReceipt), "Steering message date used by steering timeout: receipt or frame (frame creation time)")
+	flag.StringVar(&steeringFailsafe, "steering-failsafe", string(throttle.FailsafeNeutral), "Throttle to publish on steering timeout: neutral, brake or crawl")
+	flag.Float64Var(&steeringFailsafeThrottle, "steering-failsafe-throttle", 0., "Throttle value for brake (negative) or crawl (positive) steering failsafe")
+
+	flag.BoolVar(&enableSafeTransitions, "enable-safe-transitions", false, "Publish safe throttle on drive mode transitions")
+	flag.Float64Var(&pilotExitThrottle, "pilot-exit-throttle", 0., "Throttle to publish when leaving PILOT mode, 0 for neutral or negative value to brake")
+	flag.Float64Var(&invalidModeThrottle, "invalid-mode-throttle", 0., "Throttle to publish on INVALID drive mode, 0 for neutral or negative value to brake")
+	flag.DurationVar(&transitionHoldDuration, "transition-hold-duration", 500*time.Millisecond, "Duration to publish pilot exit or invalid mode throttle before neutral")
+	flag.DurationVar(&pilotSoftStart, "pilot-soft-start", 0, "Ramp up duration of autopilot throttle when entering PILOT mode, disabled if 0")
+
+	flag.Float64Var(&eStopBrakeThrottle, "estop-brake-throttle", -1., "Brake throttle to publish on emergency stop, before neutral")
+	flag.DurationVar(&eStopBrakeDuration, "estop-brake-duration", 500*time.Millisecond, "Brake duration on emergency stop, before neutral")
+	flag.StringVar(&eStopResetToken, "estop-reset-token", os.Getenv("ESTOP_RESET_TOKEN"), "Token to release emergency stop, use ESTOP_RESET_TOKEN if args not set")
+
 	flag.BoolVar(&enableBrake, "enable-brake-feature", false, "Enable brake to slow car on throttle changes")
 	flag.StringVar(&brakeConfig, "brake-configuration", "", "Json file to use to configure brake adaptation when --enable-brake is `true`")
-	flag.Float64Var(&acceleratorFactor, "accelerator-factor", 1.0, "Accelerator factor when --enable-bake is 'true'")
+	flag.StringVar(&brakeMode, "brake-mode", "custom", "Brake controller to use when --enable-brake-feature is `true`: custom, pulse or speed")
+	flag.StringVar(&configFileBrakePulse, "brake-pulse-config", "", "Json file to configure brake pulses when --brake-mode is 'pulse'")
+	flag.StringVar(&configFileBrakeSpeed, "brake-speed-config", "", "Json file to configure speed based brake when --brake-mode is 'speed'")
+	flag.StringVar(&configFileSlewLimiter, "slew-limiter-config", "", "Json file to configure max throttle rate and jerk of published throttle, except rc throttle on user mode and safety values (e-stop, failsafe, dead-man, transitions), output isn't limited if not set")
+	flag.StringVar(&escProfile, "esc-profile", string(brake.ESCForwardBrake), "ESC behaviour on negative values: forward_brake, forward_brake_reverse (double-tap) or crawler")
+	flag.DurationVar(&escNeutralDuration, "esc-neutral-duration", 100*time.Millisecond, "Neutral interval inserted between brake and forward throttle with forward_brake_reverse ESC profile")
+	flag.DurationVar(&brakeFeedbackTimeout, "brake-feedback-timeout", 0, "Switch custom brake controller to degraded mode when no throttle feedback is received since this duration, disabled if 0")
+	flag.StringVar(&brakeDegradedMode, "brake-degraded-mode", string(brake.DegradedPassthrough), "Custom brake controller behaviour on stale feedback: passthrough or capped")
+	flag.Float64Var(&brakeDegradedMaxThrottle, "brake-degraded-max-throttle", 0.2, "Max throttle when --brake-degraded-mode is 'capped'")
+	flag.Float64Var(&acceleratorFactor, "accelerator-factor", 1.0, "Accelerator factor when --enable-bake is 'true', ignored if brake configuration defines an acceleration curve")
 
 	flag.BoolVar(&enableCustomSteeringProcessor, "enable-custom-steering-processor", false, "Enable custom steering processor to estimate throttle")
 	flag.StringVar(&configFileSteeringProcessor, "custom-steering-processor-config", "", "Path to json config to parameter custom steering processor")
 
+	flag.BoolVar(&enablePIDProcessor, "enable-pid-processor", false, "Enable closed-loop pid processor, steering throttle is corrected with throttle feedback")
+	flag.StringVar(&configFilePIDProcessor, "pid-processor-config", "", "Path to json config to parameter pid processor")
+
+	flag.StringVar(&configFilePipelineProcessor, "pipeline-processor-config", "", "Path to json config that describes a pipeline of processors to combine, pipeline is disabled if not set")
+
+	flag.StringVar(&configFileScriptProcessor, "script-processor-config", "", "Path to json config of starlark script processor, script processor is disabled if not set")
+
+	flag.BoolVar(&enableRoadProcessor, "enable-road-processor", false, "Estimate throttle from road geometry, fallback to steering processor on low confidence")
+	flag.StringVar(&configFileRoadProcessor, "road-processor-config", "", "Path to json config to parameter road processor")
+
+	flag.BoolVar(&enableAnticipatoryProcessor, "enable-anticipatory-processor", false, "Adjust throttle from steering rate of change, cut on corner entry and boost on corner exit")
+	flag.StringVar(&configFileAnticipatoryProcessor, "anticipatory-processor-config", "", "Path to json config to parameter anticipatory processor")
+
+	flag.BoolVar(&enableLapLearning, "enable-lap-learning", false, "Learn a throttle profile lap after lap")
+	flag.StringVar(&configFileLapLearning, "lap-learning-config", "", "Path to json config to parameter lap learning")
+
+	flag.StringVar(&configFileRaceStart, "race-start-config", "", "Path to json config with launch profile, on PILOT mode throttle stays neutral until race start signal if set")
+
+	flag.BoolVar(&enableACC, "enable-acc", false, "Enable adaptive cruise control to keep time gap with cars ahead")
+	flag.StringVar(&configFileACC, "acc-config", "", "Path to json config to parameter adaptive cruise control")
+
+	flag.BoolVar(&enableSpeedBump, "enable-speed-bump", false, "Slow down when speed bump is detected ahead")
+	flag.StringVar(&configFileSpeedBump, "speed-bump-config", "", "Path to json config to parameter speed bump crossing")
+
+	flag.StringVar(&configFileConfidenceCurve, "confidence-curve-config", "", "Path to json config that maps autopilot confidence to a throttle factor, throttle isn't scaled if not set")
+
 	flag.BoolVar(&enableSpeedZone, "enable-speed-zone", false, "Enable speed zone information to estimate throttle")
+	flag.StringVar(&configFileSpeedZone, "speed-zone-config", "", "Path to json config with steering table by speed zone, zone throttle and steering flags are ignored if set")
 	flag.Float64Var(&slowZoneThrottle, "slow-zone-throttle", 0.11, "Throttle target for slow speed zone")
 	flag.Float64Var(&normalZoneThrottle, "normal-zone-throttle", 0.12, "Throttle target for normal speed zone")
 	flag.Float64Var(&fastZoneThrottle, "fast-zone-throttle", 0.13, "Throttle target for fast speed zone")
 	flag.Float64Var(&moderateSteering, "moderate-steering", 0.3, "Steering above is considered as moderate")
 	flag.Float64Var(&fullSteering, "full-steering", 0.8, "Steering above is considered as full")
 
+	flag.IntVar(&speedZoneUpgradeMessages, "speed-zone-upgrade-messages", 0, "Number of consistent messages before accepting a faster speed zone, 0 to disable")
+	flag.IntVar(&speedZoneDowngradeMessages, "speed-zone-downgrade-messages", 0, "Number of consistent messages before accepting a slower speed zone, 0 to disable")
+	flag.DurationVar(&speedZoneUpgradeDwell, "speed-zone-upgrade-dwell", 0, "Minimum dwell time before accepting a faster speed zone, 0 to disable")
+	flag.DurationVar(&speedZoneDowngradeDwell, "speed-zone-downgrade-dwell", 0, "Minimum dwell time before accepting a slower speed zone, 0 to disable")
+	flag.Float64Var(&speedZoneRampRate, "speed-zone-ramp-rate", 0., "Max throttle variation by second after a speed zone change, 0 to disable")
+
 	logLevel := zap.LevelFlag("log", zap.InfoLevel, "log level")
 
 	flag.Parse()
@@ -98,16 +215,64 @@ func main() {
 	zap.S().Infof("Topic steering                 : %s", steeringTopic)
 	zap.S().Infof("Topic drive mode               : %s", driveModeTopic)
 	zap.S().Infof("Topic speed zone               : %s", speedZoneTopic)
+	zap.S().Infof("Topic road                     : %s", roadTopic)
+	zap.S().Infof("Topic objects                  : %s", objectsTopic)
+	zap.S().Infof("Topic lap                      : %s", lapTopic)
+	zap.S().Infof("Topic race start               : %s", raceStartTopic)
+	zap.S().Infof("Topic odometry                 : %s", odometryTopic)
+	zap.S().Infof("Topic status                   : %s", statusTopic)
+	zap.S().Infof("Topic e-stop                   : %s", eStopTopic)
 	zap.S().Infof("Min throttle                   : %v", minThrottle)
 	zap.S().Infof("Max throttle                   : %v", maxThrottle)
 	zap.S().Infof("Publish frequency              : %vHz", publishPilotFrequency)
+	zap.S().Infof("Copilot strategy               : %v", copilotStrategy)
+	zap.S().Infof("Copilot blend weight           : %v", copilotBlendWeight)
+	zap.S().Infof("Dead-man enabled               : %v", enableDeadMan)
+	zap.S().Infof("Dead-man threshold             : %v", deadManThreshold)
+	zap.S().Infof("Dead-man timeout               : %v", deadManTimeout)
+	zap.S().Infof("Dead-man release throttle      : %v", deadManReleaseThrottle)
+	zap.S().Infof("Steering timeout               : %v", steeringTimeout)
+	zap.S().Infof("Steering timestamp             : %v", steeringTimestamp)
+	zap.S().Infof("Steering failsafe              : %v", steeringFailsafe)
+	zap.S().Infof("Steering failsafe throttle     : %v", steeringFailsafeThrottle)
+	zap.S().Infof("Safe transitions enabled       : %v", enableSafeTransitions)
+	zap.S().Infof("Pilot exit throttle            : %v", pilotExitThrottle)
+	zap.S().Infof("Invalid mode throttle          : %v", invalidModeThrottle)
+	zap.S().Infof("Transition hold duration       : %v", transitionHoldDuration)
+	zap.S().Infof("Pilot soft start               : %v", pilotSoftStart)
+	zap.S().Infof("E-stop brake throttle          : %v", eStopBrakeThrottle)
+	zap.S().Infof("E-stop brake duration          : %v", eStopBrakeDuration)
+	zap.S().Infof("E-stop reset token defined     : %v", eStopResetToken != "")
 	zap.S().Infof("Brake enabled                  : %v", enableBrake)
+	zap.S().Infof("Brake mode                     : %v", brakeMode)
+	zap.S().Infof("Brake pulse config             : %v", configFileBrakePulse)
+	zap.S().Infof("Brake speed config             : %v", configFileBrakeSpeed)
+	zap.S().Infof("Slew limiter config            : %v", configFileSlewLimiter)
+	zap.S().Infof("ESC profile                    : %v", escProfile)
+	zap.S().Infof("ESC neutral duration           : %v", escNeutralDuration)
+	zap.S().Infof("Brake feedback timeout         : %v", brakeFeedbackTimeout)
+	zap.S().Infof("Brake degraded mode            : %v", brakeDegradedMode)
+	zap.S().Infof("Brake degraded max throttle    : %v", brakeDegradedMaxThrottle)
 	zap.S().Infof("Accelerator factor             : %v", acceleratorFactor)
 	zap.S().Infof("CustomSteeringProcessor enabled: %v", enableCustomSteeringProcessor)
+	zap.S().Infof("PIDProcessor enabled           : %v", enablePIDProcessor)
+	zap.S().Infof("Pipeline processor config      : %v", configFilePipelineProcessor)
+	zap.S().Infof("Script processor config        : %v", configFileScriptProcessor)
+	zap.S().Infof("RoadProcessor enabled          : %v", enableRoadProcessor)
+	zap.S().Infof("Anticipatory enabled           : %v", enableAnticipatoryProcessor)
+	zap.S().Infof("Lap learning enabled           : %v", enableLapLearning)
+	zap.S().Infof("Race start config              : %v", configFileRaceStart)
+	zap.S().Infof("ACC enabled                    : %v", enableACC)
+	zap.S().Infof("SpeedBump enabled              : %v", enableSpeedBump)
+	zap.S().Infof("Confidence curve config        : %v", configFileConfidenceCurve)
 	zap.S().Infof("SpeedZone enabled              : %v", enableSpeedZone)
+	zap.S().Infof("SpeedZone config               : %v", configFileSpeedZone)
 	zap.S().Infof("SpeedZone slow throttle        : %v", slowZoneThrottle)
 	zap.S().Infof("SpeedZone normal throttle      : %v", normalZoneThrottle)
 	zap.S().Infof("SpeedZone fast throttle        : %v", fastZoneThrottle)
+	zap.S().Infof("SpeedZone upgrade debounce     : %v messages, %v", speedZoneUpgradeMessages, speedZoneUpgradeDwell)
+	zap.S().Infof("SpeedZone downgrade debounce   : %v messages, %v", speedZoneDowngradeMessages, speedZoneDowngradeDwell)
+	zap.S().Infof("SpeedZone ramp rate            : %v", speedZoneRampRate)
 	zap.S().Infof("Steering moderate              : %v", moderateSteering)
 	zap.S().Infof("Steering full                  : %v", fullSteering)
 
@@ -118,23 +283,90 @@ func main() {
 	defer client.Disconnect(50)
 
 	var brakeCtrl brake.Controller
-	if enableBrake {
-		brakeCtrl = brake.NewCustomControllerWithJsonConfigAndAcceleratorFactor(brakeConfig, acceleratorFactor)
+	if enableBrake && brakeMode == "pulse" {
+		cfg, err := brake.NewPulseConfigFromJson(configFileBrakePulse)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileBrakePulse, err)
+		}
+		brakeCtrl = brake.NewPulseController(cfg)
+	} else if enableBrake && brakeMode == "speed" {
+		if odometryTopic == "" {
+			zap.S().Fatalf("speed brake mode needs odometry topic, set --mqtt-topic-odometry")
+		}
+		cfg, err := brake.NewSpeedConfigFromJson(configFileBrakeSpeed)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileBrakeSpeed, err)
+		}
+		brakeCtrl = brake.NewSpeedController(cfg)
+	} else if enableBrake && brakeMode == "custom" {
+		var brakeOpts []brake.CustomOption
+		if brakeFeedbackTimeout > 0 {
+			mode, err := brake.NewDegradedMode(brakeDegradedMode)
+			if err != nil {
+				zap.S().Fatalf("invalid flag: %v", err)
+			}
+			brakeOpts = append(brakeOpts, brake.WithFeedbackTimeout(brakeFeedbackTimeout, mode,
+				types.Throttle(brakeDegradedMaxThrottle)))
+		}
+		brakeCtrl = brake.NewCustomControllerWithJsonConfigAndAcceleratorFactor(brakeConfig, acceleratorFactor,
+			brakeOpts...)
+	} else if enableBrake {
+		zap.S().Fatalf("invalid flag, unknown brake mode '%v', accepted values: custom, pulse, speed", brakeMode)
 	} else {
 		brakeCtrl = &brake.DisabledController{}
 	}
+	// Slew limiter and ESC profile are applied on published values, safety values bypass slew limiter
+	var output brake.Controller = &brake.DisabledController{}
+	if configFileSlewLimiter != "" {
+		cfg, err := brake.NewSlewConfigFromJson(configFileSlewLimiter)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileSlewLimiter, err)
+		}
+		output = brake.NewSlewController(output, cfg)
+	}
+	profile, err := brake.NewESCProfile(escProfile)
+	if err != nil {
+		zap.S().Fatalf("invalid flag: %v", err)
+	}
+	output = brake.NewESCController(output, profile, escNeutralDuration)
 
-	if enableSpeedZone && enableCustomSteeringProcessor {
-		zap.S().Panicf("invalid flag, speedZone and customSteering processor can't be enabled at the same time")
+	strategy, err := throttle.NewCopilotStrategy(copilotStrategy)
+	if err != nil {
+		zap.S().Fatalf("invalid flag: %v", err)
+	}
+	if strategy == throttle.CopilotBrake && !enableBrake {
+		zap.S().Fatalf("brake copilot strategy needs brake feature, set --enable-brake-feature")
+	}
+	if copilotBlendWeight < 0. || copilotBlendWeight > 1. {
+		zap.S().Fatalf("invalid flag, copilot blend weight must be between 0 and 1: %v", copilotBlendWeight)
+	}
+
+	if countEnabled(enableSpeedZone, enableCustomSteeringProcessor, enablePIDProcessor, configFilePipelineProcessor != "",
+		configFileScriptProcessor != "") > 1 {
+		zap.S().Panicf("invalid flag, only one of speedZone, customSteering, pid, pipeline or script processor can be enabled at the same time")
 	}
 	var throttleProcessor throttle.Processor
-	if enableSpeedZone {
+	speedZoneOpts := []throttle.SpeedZoneOption{
+		throttle.WithSpeedZoneDebounce(
+			throttle.ZoneDebounce{Messages: speedZoneUpgradeMessages, Dwell: speedZoneUpgradeDwell},
+			throttle.ZoneDebounce{Messages: speedZoneDowngradeMessages, Dwell: speedZoneDowngradeDwell},
+		),
+		throttle.WithSpeedZoneRamp(speedZoneRampRate),
+	}
+	if enableSpeedZone && configFileSpeedZone != "" {
+		cfg, err := throttle.NewSpeedZoneConfigFromJson(configFileSpeedZone)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileSpeedZone, err)
+		}
+		throttleProcessor = throttle.NewSpeedZoneProcessorWithConfig(cfg, speedZoneOpts...)
+	} else if enableSpeedZone {
 		throttleProcessor = throttle.NewSpeedZoneProcessor(
 			types.Throttle(slowZoneThrottle),
 			types.Throttle(normalZoneThrottle),
 			types.Throttle(fastZoneThrottle),
 			moderateSteering,
 			fullSteering,
+			speedZoneOpts...,
 		)
 	} else if enableCustomSteeringProcessor {
 		cfg, err := throttle.NewConfigFromJson(configFileSteeringProcessor)
@@ -142,14 +374,149 @@ func main() {
 			zap.S().Fatalf("unable to load config '%v': %v", configFileSteeringProcessor, err)
 		}
 		throttleProcessor = throttle.NewCustomSteeringProcessor(cfg)
+	} else if configFilePipelineProcessor != "" {
+		throttleProcessor, err = throttle.NewPipelineProcessorFromJson(configFilePipelineProcessor)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFilePipelineProcessor, err)
+		}
+	} else if configFileScriptProcessor != "" {
+		cfg, err := throttle.NewScriptConfigFromJson(configFileScriptProcessor)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileScriptProcessor, err)
+		}
+		throttleProcessor, err = throttle.NewScriptProcessor(cfg)
+		if err != nil {
+			zap.S().Fatalf("unable to load script '%v': %v", cfg.Script, err)
+		}
+	} else if enablePIDProcessor {
+		cfg, err := throttle.NewPIDConfigFromJson(configFilePIDProcessor)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFilePIDProcessor, err)
+		}
+		throttleProcessor = throttle.NewPIDProcessor(
+			throttle.NewSteeringProcessor(types.Throttle(minThrottle), types.Throttle(maxThrottle)),
+			cfg,
+		)
 	} else {
 		throttleProcessor = throttle.NewSteeringProcessor(types.Throttle(minThrottle), types.Throttle(maxThrottle))
 	}
+	if enableRoadProcessor {
+		if roadTopic == "" {
+			zap.S().Fatalf("road processor needs road topic, set --mqtt-topic-road")
+		}
+		cfg, err := throttle.NewRoadConfigFromJson(configFileRoadProcessor)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileRoadProcessor, err)
+		}
+		throttleProcessor = throttle.NewRoadGeometryProcessor(throttleProcessor, cfg)
+	}
+	if enableAnticipatoryProcessor {
+		cfg, err := throttle.NewAnticipatoryConfigFromJson(configFileAnticipatoryProcessor)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileAnticipatoryProcessor, err)
+		}
+		throttleProcessor = throttle.NewAnticipatoryProcessor(throttleProcessor, cfg)
+	}
+	if enableLapLearning {
+		cfg, err := throttle.NewLapConfigFromJson(configFileLapLearning)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileLapLearning, err)
+		}
+		if cfg.Detection == throttle.LapDetectionTopic && lapTopic == "" {
+			zap.S().Fatalf("lap learning with topic detection needs lap topic, set --mqtt-topic-lap")
+		}
+		throttleProcessor = throttle.NewLapLearningProcessor(throttleProcessor, cfg)
+	}
+
+	opts := []throttle.Option{
+		throttle.WithThrottleProcessor(throttleProcessor),
+		throttle.WithBrakeController(brakeCtrl),
+		throttle.WithOutputController(output),
+		throttle.WithRoadTopic(roadTopic),
+		throttle.WithObjectsTopic(objectsTopic),
+		throttle.WithLapTopic(lapTopic),
+		throttle.WithOdometryTopic(odometryTopic),
+		throttle.WithStatusTopic(statusTopic),
+		throttle.WithCopilotStrategy(strategy),
+		throttle.WithCopilotBlendWeight(copilotBlendWeight),
+	}
+	if enableACC {
+		if objectsTopic == "" {
+			zap.S().Fatalf("adaptive cruise control needs objects topic, set --mqtt-topic-objects")
+		}
+		cfg, err := throttle.NewACCConfigFromJson(configFileACC)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileACC, err)
+		}
+		opts = append(opts, throttle.WithLimiter(throttle.NewACCLimiter(cfg)))
+	}
+	if configFileConfidenceCurve != "" {
+		cc, err := throttle.NewConfidenceCurveFromJson(configFileConfidenceCurve)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileConfidenceCurve, err)
+		}
+		opts = append(opts, throttle.WithConfidenceCurve(cc))
+	}
+	if enableSpeedBump {
+		if objectsTopic == "" {
+			zap.S().Fatalf("speed bump limiter needs objects topic, set --mqtt-topic-objects")
+		}
+		cfg, err := throttle.NewSpeedBumpConfigFromJson(configFileSpeedBump)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileSpeedBump, err)
+		}
+		opts = append(opts, throttle.WithLimiter(throttle.NewSpeedBumpLimiter(cfg)))
+	}
+	if enableDeadMan {
+		if deadManReleaseThrottle > 0. {
+			zap.S().Fatalf("invalid flag, dead-man release throttle must be neutral or brake: %v", deadManReleaseThrottle)
+		}
+		opts = append(opts, throttle.WithDeadMan(types.Throttle(deadManThreshold), deadManTimeout,
+			types.Throttle(deadManReleaseThrottle)))
+	}
+	if eStopTopic != "" {
+		if eStopBrakeThrottle < -1. || eStopBrakeThrottle > 0. {
+			zap.S().Fatalf("invalid flag, e-stop brake throttle must be between -1 and 0: %v", eStopBrakeThrottle)
+		}
+		if eStopResetToken == "" {
+			zap.S().Fatalf("e-stop needs a reset token, set --estop-reset-token")
+		}
+		opts = append(opts, throttle.WithEStop(eStopTopic, types.Throttle(eStopBrakeThrottle), eStopBrakeDuration,
+			eStopResetToken))
+	}
+	if enableSafeTransitions {
+		if pilotExitThrottle > 0. || invalidModeThrottle > 0. {
+			zap.S().Fatalf("invalid flag, pilot exit and invalid mode throttles must be neutral or brake: %v, %v",
+				pilotExitThrottle, invalidModeThrottle)
+		}
+		opts = append(opts, throttle.WithDriveModeTransitions(types.Throttle(pilotExitThrottle),
+			types.Throttle(invalidModeThrottle), transitionHoldDuration, pilotSoftStart))
+	}
+	if steeringTimeout > 0 {
+		timestamp, err := throttle.NewSteeringTimestamp(steeringTimestamp)
+		if err != nil {
+			zap.S().Fatalf("invalid flag: %v", err)
+		}
+		failsafe, err := throttle.NewFailsafe(steeringFailsafe, types.Throttle(steeringFailsafeThrottle))
+		if err != nil {
+			zap.S().Fatalf("invalid flag: %v", err)
+		}
+		opts = append(opts, throttle.WithSteeringWatchdog(steeringTimeout, timestamp, failsafe))
+	}
+	if configFileRaceStart != "" {
+		if raceStartTopic == "" {
+			zap.S().Fatalf("race start needs race start topic, set --mqtt-topic-race-start")
+		}
+		cfg, err := throttle.NewStartConfigFromJson(configFileRaceStart)
+		if err != nil {
+			zap.S().Fatalf("unable to load config '%v': %v", configFileRaceStart, err)
+		}
+		opts = append(opts, throttle.WithStartSequencer(raceStartTopic, throttle.NewStartSequencer(cfg)))
+	}
 
 	p := throttle.New(client, throttleTopic, driveModeTopic, rcThrottleTopic, steeringTopic, throttleFeedbackTopic,
 		maxThrottleCtrlTopic, speedZoneTopic, types.Throttle(maxThrottle), 2,
-		throttle.WithThrottleProcessor(throttleProcessor),
-		throttle.WithBrakeController(brakeCtrl))
+		opts...)
 	defer p.Stop()
 
 	cli.HandleExit(p)
@@ -159,3 +526,13 @@ func main() {
 		zap.S().Fatalf("unable to start service: %v", err)
 	}
 }
+
+func countEnabled(flags ...bool) int {
+	count := 0
+	for _, f := range flags {
+		if f {
+			count++
+		}
+	}
+	return count
+}
@@ -8,6 +8,7 @@ require (
 	github.com/cyrilix/robocar-base v0.1.8
 	github.com/cyrilix/robocar-protobuf/go v1.4.0
 	github.com/eclipse/paho.mqtt.golang v1.4.3
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
 	go.uber.org/zap v1.26.0
 	google.golang.org/protobuf v1.31.0
 )
@@ -17,4 +18,5 @@ require (
 	go.uber.org/multierr v1.10.0 // indirect
 	golang.org/x/net v0.9.0 // indirect
 	golang.org/x/sync v0.1.0 // indirect
+	golang.org/x/sys v0.7.0 // indirect
 )
@@ -28,12 +28,129 @@ func NewConfigFromJson(fileName string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
 	}
+	if err := ft.validate(); err != nil {
+		return nil, fmt.Errorf("invalid brake config %s: %w", fileName, err)
+	}
 	return &ft, nil
 }
 
+type Interpolation string
+
+const (
+	// InterpolationStep keeps brake value constant until next delta step is reached
+	InterpolationStep Interpolation = "step"
+	// InterpolationLinear draws straight lines between delta steps
+	InterpolationLinear Interpolation = "linear"
+)
+
 type Config struct {
 	DeltaSteps []float32        `json:"delta_steps"`
 	Data       []types.Throttle `json:"data"`
+	// Interpolation between delta steps, default to InterpolationStep
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+	// Acceleration curve, replaces accelerator factor if defined
+	Acceleration *AccelerationConfig `json:"acceleration,omitempty"`
+}
+
+// AccelerationConfig defines accelerator factors to apply by delta between target and real throttle. Factors
+// greater than 1 accelerate harder than target, factors lower than 1 accelerate gently.
+type AccelerationConfig struct {
+	DeltaSteps []float32 `json:"delta_steps"`
+	Factors    []float32 `json:"factors"`
+	// OvershootCeiling is the max throttle applied above target throttle
+	OvershootCeiling types.Throttle `json:"overshoot_ceiling"`
+	// Interpolation between delta steps, default to InterpolationStep
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+}
+
+func (ac *AccelerationConfig) validate() error {
+	if err := validateDeltaSteps(ac.DeltaSteps, len(ac.Factors)); err != nil {
+		return err
+	}
+	for _, f := range ac.Factors {
+		if f <= 0. {
+			return fmt.Errorf("invalid accelerator factor, must be > 0.0: %v", f)
+		}
+	}
+	if ac.OvershootCeiling < 0. || ac.OvershootCeiling > 1. {
+		return fmt.Errorf("invalid overshoot ceiling, must be between 0.0 and 1.0: %v", ac.OvershootCeiling)
+	}
+	return validateInterpolation(ac.Interpolation)
+}
+
+// ValueOf returns throttle to apply to reach target throttle, target must be greater than current throttle
+func (ac *AccelerationConfig) ValueOf(currentThrottle, targetThrottle types.Throttle) types.Throttle {
+	delta := float32(targetThrottle - currentThrottle)
+	if delta < ac.DeltaSteps[0] {
+		return targetThrottle
+	}
+	factor := ac.factor(delta)
+	throttle := currentThrottle + types.Throttle(delta*factor)
+	if throttle > targetThrottle+ac.OvershootCeiling {
+		throttle = targetThrottle + ac.OvershootCeiling
+	}
+	if throttle > 1. {
+		throttle = 1.
+	}
+	return throttle
+}
+
+// factor returns accelerator factor of delta, delta must be greater than first delta step
+func (ac *AccelerationConfig) factor(delta float32) float32 {
+	for idx := 1; idx < len(ac.DeltaSteps); idx++ {
+		if delta < ac.DeltaSteps[idx] {
+			if ac.Interpolation != InterpolationLinear {
+				return ac.Factors[idx-1]
+			}
+			ratio := (delta - ac.DeltaSteps[idx-1]) / (ac.DeltaSteps[idx] - ac.DeltaSteps[idx-1])
+			return ac.Factors[idx-1] + ratio*(ac.Factors[idx]-ac.Factors[idx-1])
+		}
+	}
+	return ac.Factors[len(ac.Factors)-1]
+}
+
+func validateInterpolation(interpolation Interpolation) error {
+	switch interpolation {
+	case "", InterpolationStep, InterpolationLinear:
+		return nil
+	}
+	return fmt.Errorf("invalid interpolation '%v', accepted values: %v, %v", interpolation,
+		InterpolationStep, InterpolationLinear)
+}
+
+func validateDeltaSteps(steps []float32, dataLen int) error {
+	if len(steps) == 0 {
+		return fmt.Errorf("none delta step defined")
+	}
+	if len(steps) != dataLen {
+		return fmt.Errorf("delta steps number must be equals to data number: %v/%v", len(steps), dataLen)
+	}
+	for idx, step := range steps {
+		if idx > 0 && step <= steps[idx-1] {
+			return fmt.Errorf("delta steps must be strictly increasing: %v <= %v", step, steps[idx-1])
+		}
+	}
+	return nil
+}
+
+func (tc *Config) validate() error {
+	if err := validateDeltaSteps(tc.DeltaSteps, len(tc.Data)); err != nil {
+		return err
+	}
+	for _, d := range tc.Data {
+		if d < -1. || d > 0. {
+			return fmt.Errorf("invalid brake value, must be between -1.0 and 0.0: %v", d)
+		}
+	}
+	if err := validateInterpolation(tc.Interpolation); err != nil {
+		return err
+	}
+	if tc.Acceleration != nil {
+		if err := tc.Acceleration.validate(); err != nil {
+			return fmt.Errorf("invalid acceleration: %w", err)
+		}
+	}
+	return nil
 }
 
 func (tc *Config) ValueOf(currentThrottle, targetThrottle types.Throttle) types.Throttle {
@@ -45,6 +162,9 @@ func (tc *Config) ValueOf(currentThrottle, targetThrottle types.Throttle) types.
 	if delta >= tc.DeltaSteps[len(tc.DeltaSteps)-1] {
 		return tc.Data[len(tc.Data)-1]
 	}
+	if tc.Interpolation == InterpolationLinear {
+		return tc.linearValueOf(delta)
+	}
 	for idx, step := range tc.DeltaSteps {
 		if delta < step {
 			return tc.Data[idx-1]
@@ -52,3 +172,14 @@ func (tc *Config) ValueOf(currentThrottle, targetThrottle types.Throttle) types.
 	}
 	return tc.Data[len(tc.Data)-1]
 }
+
+// linearValueOf interpolates brake value between surrounding delta steps
+func (tc *Config) linearValueOf(delta float32) types.Throttle {
+	for idx := 1; idx < len(tc.DeltaSteps); idx++ {
+		if delta < tc.DeltaSteps[idx] {
+			ratio := (delta - tc.DeltaSteps[idx-1]) / (tc.DeltaSteps[idx] - tc.DeltaSteps[idx-1])
+			return tc.Data[idx-1] + types.Throttle(ratio)*(tc.Data[idx]-tc.Data[idx-1])
+		}
+	}
+	return tc.Data[len(tc.Data)-1]
+}
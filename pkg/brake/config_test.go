@@ -2,6 +2,7 @@ package brake
 
 import (
 	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
 	"reflect"
 	"testing"
 )
@@ -23,6 +24,83 @@ func TestNewConfigFromJson(t *testing.T) {
 			},
 			want: &defaultBrakeConfig,
 		},
+		{
+			name: "linear interpolation",
+			args: args{
+				fileName: "test_data/config_linear.json",
+			},
+			want: &Config{
+				DeltaSteps:    defaultBrakeConfig.DeltaSteps,
+				Data:          defaultBrakeConfig.Data,
+				Interpolation: InterpolationLinear,
+			},
+		},
+		{
+			name: "acceleration curve",
+			args: args{
+				fileName: "test_data/config_acceleration.json",
+			},
+			want: &Config{
+				DeltaSteps: defaultBrakeConfig.DeltaSteps,
+				Data:       defaultBrakeConfig.Data,
+				Acceleration: &AccelerationConfig{
+					DeltaSteps:       []float32{0.05, 0.2, 0.4},
+					Factors:          []float32{1.5, 2., 3.},
+					OvershootCeiling: 0.3,
+				},
+			},
+		},
+		{
+			name: "gentle acceleration curve",
+			args: args{
+				fileName: "test_data/config_gentle_acceleration.json",
+			},
+			want: &Config{
+				DeltaSteps: defaultBrakeConfig.DeltaSteps,
+				Data:       defaultBrakeConfig.Data,
+				Acceleration: &AccelerationConfig{
+					DeltaSteps:       []float32{0.05, 0.2, 0.4},
+					Factors:          []float32{0.5, 1., 2.},
+					OvershootCeiling: 0.3,
+					Interpolation:    InterpolationLinear,
+				},
+			},
+		},
+		{
+			name:    "invalid acceleration curve",
+			args:    args{fileName: "test_data/config_bad_acceleration.json"},
+			wantErr: true,
+		},
+		{
+			name:    "null acceleration factor",
+			args:    args{fileName: "test_data/config_bad_acceleration_factor.json"},
+			wantErr: true,
+		},
+		{
+			name:    "steps and data with different length",
+			args:    args{fileName: "test_data/config_bad_length.json"},
+			wantErr: true,
+		},
+		{
+			name:    "unsorted steps",
+			args:    args{fileName: "test_data/config_unsorted.json"},
+			wantErr: true,
+		},
+		{
+			name:    "brake value out of range",
+			args:    args{fileName: "test_data/config_bad_data.json"},
+			wantErr: true,
+		},
+		{
+			name:    "empty config",
+			args:    args{fileName: "test_data/config_empty.json"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown interpolation",
+			args:    args{fileName: "test_data/config_bad_interpolation.json"},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -31,6 +109,9 @@ func TestNewConfigFromJson(t *testing.T) {
 				t.Errorf("NewConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil {
+				return
+			}
 			if !reflect.DeepEqual(*got, *tt.want) {
 				t.Errorf("NewConfigFromJson() got = %v, want %v", got, tt.want)
 			}
@@ -130,3 +211,89 @@ func TestConfig_ValueOf(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_LinearValueOf(t *testing.T) {
+	cfg := Config{
+		DeltaSteps:    defaultBrakeConfig.DeltaSteps,
+		Data:          defaultBrakeConfig.Data,
+		Interpolation: InterpolationLinear,
+	}
+	tests := []struct {
+		name                            string
+		currentThrottle, targetThrottle types.Throttle
+		want                            types.Throttle
+	}{
+		{name: "delta > 0", currentThrottle: 0.5, targetThrottle: 0.8, want: 0.8},
+		{name: "delta < 1st step", currentThrottle: 0.5, targetThrottle: 0.48, want: 0.48},
+		{name: "on 1st step", currentThrottle: 0.5, targetThrottle: 0.45, want: -0.1},
+		{name: "between 1st and 2nd steps", currentThrottle: 0.5, targetThrottle: 0.325, want: -0.3},
+		{name: "between 2nd and 3rd steps", currentThrottle: 0.8, targetThrottle: 0.4, want: -0.75},
+		{name: "after last step", currentThrottle: 0.8, targetThrottle: 0.2, want: -1.},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.ValueOf(tt.currentThrottle, tt.targetThrottle)
+			if math.Abs(float64(got-tt.want)) > 0.001 {
+				t.Errorf("ValueOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccelerationConfig_ValueOf(t *testing.T) {
+	cfg := AccelerationConfig{
+		DeltaSteps:       []float32{0.05, 0.2, 0.4},
+		Factors:          []float32{1.5, 2., 3.},
+		OvershootCeiling: 0.3,
+	}
+	tests := []struct {
+		name                            string
+		currentThrottle, targetThrottle types.Throttle
+		want                            types.Throttle
+	}{
+		{name: "delta < 1st step", currentThrottle: 0.5, targetThrottle: 0.52, want: 0.52},
+		{name: "low delta", currentThrottle: 0.2, targetThrottle: 0.3, want: 0.35},
+		{name: "medium delta", currentThrottle: 0.2, targetThrottle: 0.45, want: 0.7},
+		{name: "high delta, limited by overshoot ceiling", currentThrottle: 0.1, targetThrottle: 0.6, want: 0.9},
+		{name: "high delta, limited to 1.0", currentThrottle: 0.5, targetThrottle: 0.95, want: 1.},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.ValueOf(tt.currentThrottle, tt.targetThrottle)
+			if math.Abs(float64(got-tt.want)) > 0.001 {
+				t.Errorf("ValueOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAccelerationConfig_GentleValueOf(t *testing.T) {
+	cfg := AccelerationConfig{
+		DeltaSteps:       []float32{0.05, 0.2, 0.4},
+		Factors:          []float32{0.5, 1., 2.},
+		OvershootCeiling: 0.3,
+		Interpolation:    InterpolationLinear,
+	}
+	tests := []struct {
+		name                            string
+		currentThrottle, targetThrottle types.Throttle
+		want                            types.Throttle
+	}{
+		{name: "delta < 1st step", currentThrottle: 0.5, targetThrottle: 0.52, want: 0.52},
+		// factor = 0.5 + (0.06-0.05)/0.15 * 0.5 = 0.533
+		{name: "gentle acceleration", currentThrottle: 0.2, targetThrottle: 0.26, want: 0.232},
+		// factor = 0.5 + (0.1-0.05)/0.15 * 0.5 = 0.667
+		{name: "between steps, interpolated factor", currentThrottle: 0.2, targetThrottle: 0.3, want: 0.2667},
+		// factor = 1.0 + (0.3-0.2)/0.2 * 1.0 = 1.5
+		{name: "between upper steps", currentThrottle: 0.2, targetThrottle: 0.5, want: 0.65},
+		{name: "after last step, limited by overshoot ceiling", currentThrottle: 0.1, targetThrottle: 0.6, want: 0.9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := cfg.ValueOf(tt.currentThrottle, tt.targetThrottle)
+			if math.Abs(float64(got-tt.want)) > 0.001 {
+				t.Errorf("ValueOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package brake
 
 import (
+	"fmt"
 	"github.com/cyrilix/robocar-throttle/pkg/types"
 	"go.uber.org/zap"
 	"sync"
+	"time"
 )
 
 type Controller interface {
@@ -11,37 +13,136 @@ type Controller interface {
 	AdjustThrottle(targetThrottle types.Throttle) types.Throttle
 }
 
-func NewCustomController() *CustomController {
-	return &CustomController{cfg: NewConfig()}
+// Observer is implemented by controllers that track published values, Observe is called with values published
+// without adjustment
+type Observer interface {
+	Observe(t types.Throttle)
 }
 
-func NewCustomControllerWithJsonConfig(filename string) *CustomController {
+// EmergencyAdjuster is implemented by output controllers that limit throttle variations, AdjustEmergencyThrottle
+// applies controller adjustments but never delays value
+type EmergencyAdjuster interface {
+	AdjustEmergencyThrottle(t types.Throttle) types.Throttle
+}
+
+// AdjustEmergencyThrottle adjusts a safety value, as emergency stop brake, without rate limitation. Controllers that
+// aren't EmergencyAdjuster only observe it.
+func AdjustEmergencyThrottle(ctrl Controller, t types.Throttle) types.Throttle {
+	if ea, ok := ctrl.(EmergencyAdjuster); ok {
+		return ea.AdjustEmergencyThrottle(t)
+	}
+	if o, ok := ctrl.(Observer); ok {
+		o.Observe(t)
+	}
+	return t
+}
+
+type DegradedMode string
+
+const (
+	// DegradedPassthrough returns target throttle without brake
+	DegradedPassthrough DegradedMode = "passthrough"
+	// DegradedCapped returns target throttle limited to a max value, without brake
+	DegradedCapped DegradedMode = "capped"
+)
+
+func NewDegradedMode(value string) (DegradedMode, error) {
+	switch m := DegradedMode(value); m {
+	case DegradedPassthrough, DegradedCapped:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid degraded mode '%v', accepted values: %v, %v", value,
+		DegradedPassthrough, DegradedCapped)
+}
+
+type CustomOption func(b *CustomController)
+
+// WithFeedbackTimeout switches controller to degraded mode when no throttle feedback is received since timeout.
+// maxThrottle is only used by DegradedCapped mode.
+func WithFeedbackTimeout(timeout time.Duration, mode DegradedMode, maxThrottle types.Throttle) CustomOption {
+	return func(b *CustomController) {
+		b.feedbackTimeout = timeout
+		b.degradedMode = mode
+		b.degradedMaxThrottle = maxThrottle
+	}
+}
+
+func NewCustomController(opts ...CustomOption) *CustomController {
+	return newCustomController(NewConfig(), 0., opts...)
+}
+
+func NewCustomControllerWithJsonConfig(filename string, opts ...CustomOption) *CustomController {
 	config, err := NewConfigFromJson(filename)
 	if err != nil {
 		zap.S().Panicf("unable to init brake controller with json config '%s': %v", filename, err)
 	}
-	return &CustomController{cfg: config, acceleratorFactor: 1.0}
+	return newCustomController(config, 1.0, opts...)
 }
 
-func NewCustomControllerWithJsonConfigAndAcceleratorFactor(filename string, acceleratorFactor float64) *CustomController {
+func NewCustomControllerWithJsonConfigAndAcceleratorFactor(filename string, acceleratorFactor float64, opts ...CustomOption) *CustomController {
 	config, err := NewConfigFromJson(filename)
 	if err != nil {
 		zap.S().Panicf("unable to init brake controller with json config '%s': %v", filename, err)
 	}
-	return &CustomController{cfg: config, acceleratorFactor: acceleratorFactor}
+	return newCustomController(config, acceleratorFactor, opts...)
+}
+
+func newCustomController(cfg *Config, acceleratorFactor float64, opts ...CustomOption) *CustomController {
+	b := &CustomController{cfg: cfg, acceleratorFactor: acceleratorFactor, clock: time.Now}
+	for _, o := range opts {
+		o(b)
+	}
+	return b
 }
 
 type CustomController struct {
 	muRealThrottle    sync.RWMutex
 	realThrottle      types.Throttle
+	lastFeedback      time.Time
 	cfg               *Config
 	acceleratorFactor float64
+
+	clock               func() time.Time
+	feedbackTimeout     time.Duration
+	degradedMode        DegradedMode
+	degradedMaxThrottle types.Throttle
+
+	muDegraded sync.Mutex
+	degraded   bool
 }
 
 func (b *CustomController) SetRealThrottle(t types.Throttle) {
 	b.muRealThrottle.Lock()
 	defer b.muRealThrottle.Unlock()
 	b.realThrottle = t
+	if b.feedbackTimeout > 0 {
+		b.lastFeedback = b.clock()
+	}
+}
+
+// isDegraded returns true if feedback timeout is enabled and last feedback is too old
+func (b *CustomController) isDegraded() bool {
+	if b.feedbackTimeout <= 0 {
+		return false
+	}
+	b.muRealThrottle.RLock()
+	lastFeedback := b.lastFeedback
+	b.muRealThrottle.RUnlock()
+
+	degraded := lastFeedback.IsZero() || b.clock().Sub(lastFeedback) > b.feedbackTimeout
+
+	b.muDegraded.Lock()
+	defer b.muDegraded.Unlock()
+	if degraded != b.degraded {
+		if degraded {
+			zap.S().Warnf("no throttle feedback since %v, switch brake controller to %v mode", b.feedbackTimeout,
+				b.degradedMode)
+		} else {
+			zap.S().Infof("throttle feedback restored, leave brake controller %v mode", b.degradedMode)
+		}
+		b.degraded = degraded
+	}
+	return degraded
 }
 
 func (b *CustomController) GetRealThrottle() types.Throttle {
@@ -52,6 +153,15 @@ func (b *CustomController) GetRealThrottle() types.Throttle {
 }
 
 func (b *CustomController) AdjustThrottle(targetThrottle types.Throttle) types.Throttle {
+	if b.isDegraded() {
+		if b.degradedMode == DegradedCapped && targetThrottle > b.degradedMaxThrottle {
+			return b.degradedMaxThrottle
+		}
+		return targetThrottle
+	}
+	if targetThrottle > b.GetRealThrottle() && b.cfg.Acceleration != nil {
+		return b.cfg.Acceleration.ValueOf(b.GetRealThrottle(), targetThrottle)
+	}
 	if targetThrottle > b.GetRealThrottle() {
 		throttle := b.GetRealThrottle() + (targetThrottle-b.GetRealThrottle())*types.Throttle(b.acceleratorFactor)
 		if throttle > 1.0 {
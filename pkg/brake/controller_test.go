@@ -2,7 +2,9 @@ package brake
 
 import (
 	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
 	"testing"
+	"time"
 )
 
 func TestController_AdjustThrottle(t *testing.T) {
@@ -134,3 +136,111 @@ func TestDisabledController_AdjustThrottle(t *testing.T) {
 		})
 	}
 }
+
+func TestCustomController_FeedbackTimeout(t *testing.T) {
+	type step struct {
+		elapsed        time.Duration
+		feedback       *types.Throttle
+		targetThrottle types.Throttle
+		want           types.Throttle
+	}
+	feedback := func(t types.Throttle) *types.Throttle { return &t }
+	tests := []struct {
+		name  string
+		mode  DegradedMode
+		steps []step
+	}{
+		{
+			name: "no feedback received",
+			mode: DegradedPassthrough,
+			steps: []step{
+				{targetThrottle: 0.2, want: 0.2},
+			},
+		},
+		{
+			name: "fresh feedback",
+			mode: DegradedPassthrough,
+			steps: []step{
+				{feedback: feedback(0.8), targetThrottle: 0.2, want: -1.},
+				{elapsed: 400 * time.Millisecond, targetThrottle: 0.2, want: -1.},
+			},
+		},
+		{
+			name: "stale feedback, passthrough",
+			mode: DegradedPassthrough,
+			steps: []step{
+				{feedback: feedback(0.8), targetThrottle: 0.2, want: -1.},
+				{elapsed: 600 * time.Millisecond, targetThrottle: 0.2, want: 0.2},
+				{elapsed: 100 * time.Millisecond, targetThrottle: 0.9, want: 0.9},
+			},
+		},
+		{
+			name: "stale feedback, capped",
+			mode: DegradedCapped,
+			steps: []step{
+				{feedback: feedback(0.8), targetThrottle: 0.2, want: -1.},
+				{elapsed: 600 * time.Millisecond, targetThrottle: 0.2, want: 0.2},
+				{elapsed: 100 * time.Millisecond, targetThrottle: 0.9, want: 0.4},
+			},
+		},
+		{
+			name: "feedback restored",
+			mode: DegradedCapped,
+			steps: []step{
+				{elapsed: 600 * time.Millisecond, targetThrottle: 0.9, want: 0.4},
+				{feedback: feedback(0.8), targetThrottle: 0.2, want: -1.},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			b := NewCustomController(WithFeedbackTimeout(500*time.Millisecond, tt.mode, 0.4))
+			b.clock = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.elapsed)
+				if s.feedback != nil {
+					b.SetRealThrottle(*s.feedback)
+				}
+				if got := b.AdjustThrottle(s.targetThrottle); got != s.want {
+					t.Errorf("step %d: AdjustThrottle() = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewDegradedMode(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    DegradedMode
+		wantErr bool
+	}{
+		{value: "passthrough", want: DegradedPassthrough},
+		{value: "capped", want: DegradedCapped},
+		{value: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := NewDegradedMode(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDegradedMode() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NewDegradedMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomController_AccelerationCurve(t *testing.T) {
+	b := NewCustomControllerWithJsonConfigAndAcceleratorFactor("test_data/config_acceleration.json", 5.)
+	b.SetRealThrottle(0.2)
+	if got := b.AdjustThrottle(0.3); math.Abs(float64(got-0.35)) > 0.001 {
+		t.Errorf("acceleration curve should replace accelerator factor: %v, want %v", got, 0.35)
+	}
+	if got := b.AdjustThrottle(0.); got != -0.1 {
+		t.Errorf("brake should use brake curve: %v, want %v", got, -0.1)
+	}
+}
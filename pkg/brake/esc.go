@@ -0,0 +1,159 @@
+package brake
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type ESCProfile string
+
+const (
+	// ESCForwardBrake is an ESC without reverse, negative values always brake
+	ESCForwardBrake ESCProfile = "forward_brake"
+	// ESCForwardBrakeReverse is a double-tap ESC: first negative value after forward brakes, negative value after
+	// brake and neutral reverses
+	ESCForwardBrakeReverse ESCProfile = "forward_brake_reverse"
+	// ESCCrawler reverses as soon as value is negative, car slows down on neutral with drag brake
+	ESCCrawler ESCProfile = "crawler"
+)
+
+func NewESCProfile(value string) (ESCProfile, error) {
+	switch p := ESCProfile(value); p {
+	case ESCForwardBrake, ESCForwardBrakeReverse, ESCCrawler:
+		return p, nil
+	}
+	return "", fmt.Errorf("invalid esc profile '%v', accepted values: %v, %v, %v", value,
+		ESCForwardBrake, ESCForwardBrakeReverse, ESCCrawler)
+}
+
+type escState int
+
+const (
+	// escUnknown until first forward throttle, ESC could be armed and reverse on negative value
+	escUnknown escState = iota
+	escForward
+	escBraking
+	// escArmed when neutral follows brake, next negative value would reverse a double-tap ESC
+	escArmed
+)
+
+// NewESCController adapts throttle and brake values from controller to ESC behaviour. Negative values are considered
+// as brake requests, they are never translated to reverse. neutralDuration is the neutral interval inserted between
+// brake and forward throttle.
+//
+// ESC state is tracked from adjusted values, so controller must see every value sent to ESC: use it as last stage
+// before publishing and call Observe for values published without adjustment.
+func NewESCController(ctrl Controller, profile ESCProfile, neutralDuration time.Duration) *ESCController {
+	return &ESCController{
+		ctrl:            ctrl,
+		profile:         profile,
+		neutralDuration: neutralDuration,
+		clock:           time.Now,
+		state:           escUnknown,
+	}
+}
+
+type ESCController struct {
+	ctrl            Controller
+	profile         ESCProfile
+	neutralDuration time.Duration
+	clock           func() time.Time
+
+	mu           sync.Mutex
+	state        escState
+	neutralStart time.Time
+}
+
+func (e *ESCController) SetRealThrottle(t types.Throttle) {
+	e.ctrl.SetRealThrottle(t)
+}
+
+func (e *ESCController) AdjustThrottle(targetThrottle types.Throttle) types.Throttle {
+	return e.applyProfile(e.ctrl.AdjustThrottle(targetThrottle))
+}
+
+// AdjustEmergencyThrottle applies ESC profile on a safety value, wrapped controller doesn't delay it
+func (e *ESCController) AdjustEmergencyThrottle(t types.Throttle) types.Throttle {
+	return e.applyProfile(AdjustEmergencyThrottle(e.ctrl, t))
+}
+
+func (e *ESCController) applyProfile(throttle types.Throttle) types.Throttle {
+	switch e.profile {
+	case ESCCrawler:
+		if throttle < 0. {
+			return 0.
+		}
+		return throttle
+	case ESCForwardBrakeReverse:
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		return e.doubleTap(throttle, true)
+	}
+	return throttle
+}
+
+// Observe updates ESC state with a value published without adjustment, as rc throttle on USER mode
+func (e *ESCController) Observe(t types.Throttle) {
+	if o, ok := e.ctrl.(Observer); ok {
+		o.Observe(t)
+	}
+	if e.profile != ESCForwardBrakeReverse {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.doubleTap(t, false)
+}
+
+// doubleTap updates ESC state with throttle, it returns value to publish if adjust is true
+func (e *ESCController) doubleTap(throttle types.Throttle, adjust bool) types.Throttle {
+	now := e.clock()
+	switch e.state {
+	case escUnknown:
+		if throttle > 0. {
+			e.state = escForward
+			return throttle
+		}
+		if throttle < 0. && !adjust {
+			// ESC brakes or reverses, wait neutral then forward
+			e.state = escBraking
+			return throttle
+		}
+		// Next negative value could reverse, stay on neutral until forward throttle
+		return 0.
+	case escBraking:
+		if throttle < 0. {
+			return throttle
+		}
+		if throttle > 0. && !adjust {
+			e.state = escForward
+			return throttle
+		}
+		zap.S().Debugf("esc: brake released, neutral until forward throttle")
+		e.state = escArmed
+		e.neutralStart = now
+		return 0.
+	case escArmed:
+		if throttle < 0. && !adjust {
+			// ESC is reversing
+			e.state = escBraking
+			return throttle
+		}
+		if throttle < 0. {
+			// ESC would reverse, stay on neutral until forward throttle
+			return 0.
+		}
+		if throttle > 0. && (!adjust || now.Sub(e.neutralStart) >= e.neutralDuration) {
+			e.state = escForward
+			return throttle
+		}
+		return 0.
+	}
+	if throttle < 0. {
+		e.state = escBraking
+	}
+	return throttle
+}
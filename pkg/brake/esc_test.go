@@ -0,0 +1,140 @@
+package brake
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestESCController_AdjustThrottle(t *testing.T) {
+	type step struct {
+		elapsed time.Duration
+		target  types.Throttle
+		want    types.Throttle
+	}
+	tests := []struct {
+		name    string
+		profile ESCProfile
+		steps   []step
+	}{
+		{
+			name:    "forward/brake",
+			profile: ESCForwardBrake,
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{target: -1., want: -1.},
+				{target: 0., want: 0.},
+				{target: -1., want: -1.},
+			},
+		},
+		{
+			name:    "crawler",
+			profile: ESCCrawler,
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{target: -1., want: 0.},
+				{target: 0.3, want: 0.3},
+			},
+		},
+		{
+			name:    "double-tap, continuous brake",
+			profile: ESCForwardBrakeReverse,
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{target: -0.5, want: -0.5},
+				{target: -1., want: -1.},
+			},
+		},
+		{
+			name:    "double-tap, brake after neutral",
+			profile: ESCForwardBrakeReverse,
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{target: -1., want: -1.},
+				{target: 0., want: 0.},
+				{elapsed: 200 * time.Millisecond, target: -1., want: 0.},
+			},
+		},
+		{
+			name:    "double-tap, unknown initial state",
+			profile: ESCForwardBrakeReverse,
+			steps: []step{
+				{target: -0.5, want: 0.},
+				{target: 0., want: 0.},
+				{target: 0.3, want: 0.3},
+				{target: -0.5, want: -0.5},
+			},
+		},
+		{
+			name:    "double-tap, forward after brake",
+			profile: ESCForwardBrakeReverse,
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{target: -0.5, want: -0.5},
+				{target: 0.3, want: 0.},
+				{elapsed: 50 * time.Millisecond, target: 0.3, want: 0.},
+				{elapsed: 60 * time.Millisecond, target: 0.3, want: 0.3},
+				{target: -0.5, want: -0.5},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			e := NewESCController(&DisabledController{}, tt.profile, 100*time.Millisecond)
+			e.clock = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.elapsed)
+				if got := e.AdjustThrottle(s.target); got != s.want {
+					t.Errorf("step %d: AdjustThrottle() = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestESCController_Observe(t *testing.T) {
+	now := time.Now()
+	e := NewESCController(&DisabledController{}, ESCForwardBrakeReverse, 100*time.Millisecond)
+	e.clock = func() time.Time { return now }
+
+	// Values published without adjustment, as rc throttle
+	for _, v := range []types.Throttle{0.5, -0.5, 0.} {
+		e.Observe(v)
+	}
+	if got := e.AdjustThrottle(-0.5); got != 0. {
+		t.Errorf("brake after observed brake and neutral would reverse, AdjustThrottle() = %v, want %v", got, 0.)
+	}
+
+	// User reverses on purpose
+	e.Observe(-0.5)
+	e.Observe(0.3)
+	if got := e.AdjustThrottle(-0.5); got != -0.5 {
+		t.Errorf("brake after observed forward throttle, AdjustThrottle() = %v, want %v", got, -0.5)
+	}
+}
+
+func TestNewESCProfile(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    ESCProfile
+		wantErr bool
+	}{
+		{value: "forward_brake", want: ESCForwardBrake},
+		{value: "forward_brake_reverse", want: ESCForwardBrakeReverse},
+		{value: "crawler", want: ESCCrawler},
+		{value: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := NewESCProfile(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewESCProfile() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NewESCProfile() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
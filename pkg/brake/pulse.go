@@ -0,0 +1,126 @@
+package brake
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+func NewPulseConfigFromJson(fileName string) (*PulseConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg PulseConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if len(cfg.Bands) == 0 {
+		return nil, fmt.Errorf("no pulse band defined")
+	}
+	for idx, b := range cfg.Bands {
+		if idx > 0 && b.MinDelta <= cfg.Bands[idx-1].MinDelta {
+			return nil, fmt.Errorf("invalid band %d, min_delta must be strictly increasing: %v", idx, b.MinDelta)
+		}
+		if b.MinDelta <= 0. {
+			return nil, fmt.Errorf("invalid band %d, min_delta must be > 0: %v", idx, b.MinDelta)
+		}
+		if b.DurationMs <= 0 {
+			return nil, fmt.Errorf("invalid band %d, duration must be > 0: %v", idx, b.DurationMs)
+		}
+		if b.Intensity < -1. || b.Intensity >= 0. {
+			return nil, fmt.Errorf("invalid band %d, intensity must be in [-1, 0[: %v", idx, b.Intensity)
+		}
+	}
+	if cfg.CooldownMs < 0 {
+		return nil, fmt.Errorf("invalid cooldown, value must be >= 0: %v", cfg.CooldownMs)
+	}
+	return &cfg, nil
+}
+
+type PulseConfig struct {
+	// Bands sorted by min delta, band with the highest min delta lower than difference between real and target
+	// throttle is applied
+	Bands []PulseBand `json:"bands"`
+	// CooldownMs is the min duration between end of pulse and next pulse
+	CooldownMs int `json:"cooldown_ms"`
+}
+
+type PulseBand struct {
+	MinDelta   float32        `json:"min_delta"`
+	DurationMs int            `json:"duration_ms"`
+	Intensity  types.Throttle `json:"intensity"`
+}
+
+// NewPulseController build a brake controller that brakes with time limited pulses instead of braking until real
+// throttle reaches target
+func NewPulseController(cfg *PulseConfig) *PulseController {
+	return &PulseController{
+		cfg:   cfg,
+		clock: time.Now,
+	}
+}
+
+type PulseController struct {
+	muRealThrottle sync.RWMutex
+	realThrottle   types.Throttle
+
+	cfg   *PulseConfig
+	clock func() time.Time
+
+	muPulse        sync.Mutex
+	pulseEnd       time.Time
+	pulseIntensity types.Throttle
+	cooldownEnd    time.Time
+}
+
+func (p *PulseController) SetRealThrottle(t types.Throttle) {
+	p.muRealThrottle.Lock()
+	defer p.muRealThrottle.Unlock()
+	p.realThrottle = t
+}
+
+func (p *PulseController) GetRealThrottle() types.Throttle {
+	p.muRealThrottle.RLock()
+	defer p.muRealThrottle.RUnlock()
+	return p.realThrottle
+}
+
+func (p *PulseController) AdjustThrottle(targetThrottle types.Throttle) types.Throttle {
+	p.muPulse.Lock()
+	defer p.muPulse.Unlock()
+
+	now := p.clock()
+	if now.Before(p.pulseEnd) {
+		return p.pulseIntensity
+	}
+	if now.Before(p.cooldownEnd) {
+		return targetThrottle
+	}
+
+	band := p.bandOf(float32(p.GetRealThrottle() - targetThrottle))
+	if band == nil {
+		return targetThrottle
+	}
+	p.pulseEnd = now.Add(time.Duration(band.DurationMs) * time.Millisecond)
+	p.cooldownEnd = p.pulseEnd.Add(time.Duration(p.cfg.CooldownMs) * time.Millisecond)
+	p.pulseIntensity = band.Intensity
+	zap.S().Debugf("brake pulse: %v during %vms", band.Intensity, band.DurationMs)
+	return band.Intensity
+}
+
+func (p *PulseController) bandOf(delta float32) *PulseBand {
+	var band *PulseBand
+	for idx := range p.cfg.Bands {
+		if delta < p.cfg.Bands[idx].MinDelta {
+			break
+		}
+		band = &p.cfg.Bands[idx]
+	}
+	return band
+}
@@ -0,0 +1,128 @@
+package brake
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var pulseConfig = PulseConfig{
+	Bands: []PulseBand{
+		{MinDelta: 0.1, DurationMs: 100, Intensity: -0.3},
+		{MinDelta: 0.3, DurationMs: 200, Intensity: -0.8},
+	},
+	CooldownMs: 300,
+}
+
+func TestPulseController_AdjustThrottle(t *testing.T) {
+	type step struct {
+		elapsed        time.Duration
+		realThrottle   types.Throttle
+		targetThrottle types.Throttle
+		want           types.Throttle
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "no brake needed",
+			steps: []step{
+				{realThrottle: 0.3, targetThrottle: 0.5, want: 0.5},
+				{realThrottle: 0.5, targetThrottle: 0.45, want: 0.45},
+			},
+		},
+		{
+			name: "small delta",
+			steps: []step{
+				{realThrottle: 0.5, targetThrottle: 0.35, want: -0.3},
+				{elapsed: 50 * time.Millisecond, realThrottle: 0.5, targetThrottle: 0.35, want: -0.3},
+				{elapsed: 60 * time.Millisecond, realThrottle: 0.5, targetThrottle: 0.35, want: 0.35},
+			},
+		},
+		{
+			name: "big delta",
+			steps: []step{
+				{realThrottle: 0.8, targetThrottle: 0.2, want: -0.8},
+				{elapsed: 150 * time.Millisecond, realThrottle: 0.6, targetThrottle: 0.2, want: -0.8},
+				{elapsed: 60 * time.Millisecond, realThrottle: 0.6, targetThrottle: 0.2, want: 0.2},
+			},
+		},
+		{
+			name: "cooldown",
+			steps: []step{
+				{realThrottle: 0.8, targetThrottle: 0.2, want: -0.8},
+				{elapsed: 300 * time.Millisecond, realThrottle: 0.6, targetThrottle: 0.2, want: 0.2},
+				{elapsed: 150 * time.Millisecond, realThrottle: 0.6, targetThrottle: 0.2, want: 0.2},
+				{elapsed: 100 * time.Millisecond, realThrottle: 0.6, targetThrottle: 0.2, want: -0.8},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			p := NewPulseController(&pulseConfig)
+			p.clock = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.elapsed)
+				p.SetRealThrottle(s.realThrottle)
+				if got := p.AdjustThrottle(s.targetThrottle); got != s.want {
+					t.Errorf("step %d: AdjustThrottle() = %v, want %v", i, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestNewPulseConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "valid config",
+			configContent: `{"bands": [{"min_delta": 0.1, "duration_ms": 100, "intensity": -0.3}, {"min_delta": 0.3, "duration_ms": 200, "intensity": -0.8}], "cooldown_ms": 300}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "bands" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "no band",
+			configContent: `{"bands": [], "cooldown_ms": 300}`,
+			wantErr:       true,
+		},
+		{
+			name:          "unsorted bands",
+			configContent: `{"bands": [{"min_delta": 0.3, "duration_ms": 100, "intensity": -0.3}, {"min_delta": 0.1, "duration_ms": 200, "intensity": -0.8}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "no duration",
+			configContent: `{"bands": [{"min_delta": 0.1, "intensity": -0.3}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "positive intensity",
+			configContent: `{"bands": [{"min_delta": 0.1, "duration_ms": 100, "intensity": 0.3}]}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewPulseConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPulseConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
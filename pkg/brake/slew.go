@@ -0,0 +1,169 @@
+package brake
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultIdleReset = 1 * time.Second
+
+func NewSlewConfigFromJson(fileName string) (*SlewConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg SlewConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.AccelerationRate <= 0. {
+		return nil, fmt.Errorf("invalid acceleration rate, value must be > 0: %v", cfg.AccelerationRate)
+	}
+	if cfg.DecelerationRate <= 0. {
+		return nil, fmt.Errorf("invalid deceleration rate, value must be > 0: %v", cfg.DecelerationRate)
+	}
+	if cfg.IdleResetMs < 0 {
+		return nil, fmt.Errorf("invalid idle reset, value must be >= 0: %v", cfg.IdleResetMs)
+	}
+	if cfg.JerkLimit < 0. {
+		return nil, fmt.Errorf("invalid jerk limit, value must be >= 0: %v", cfg.JerkLimit)
+	}
+	if cfg.EmergencyThreshold != nil && (*cfg.EmergencyThreshold < -1. || *cfg.EmergencyThreshold >= 0.) {
+		return nil, fmt.Errorf("invalid emergency threshold, value must be in [-1, 0[: %v", *cfg.EmergencyThreshold)
+	}
+	return &cfg, nil
+}
+
+type SlewConfig struct {
+	// AccelerationRate is the max throttle increase by second
+	AccelerationRate float64 `json:"acceleration_rate"`
+	// DecelerationRate is the max throttle decrease by second
+	DecelerationRate float64 `json:"deceleration_rate"`
+	// JerkLimit is the max rate change by second², jerk isn't limited if 0
+	JerkLimit float64 `json:"jerk_limit,omitempty"`
+	// EmergencyThreshold, brake commands lower or equal are applied immediately
+	EmergencyThreshold *types.Throttle `json:"emergency_threshold,omitempty"`
+	// IdleResetMs, limiter restarts from real throttle when no value is adjusted or observed since this duration,
+	// default to 1s
+	IdleResetMs int `json:"idle_reset_ms,omitempty"`
+}
+
+func (c *SlewConfig) idleReset() time.Duration {
+	if c.IdleResetMs <= 0 {
+		return defaultIdleReset
+	}
+	return time.Duration(c.IdleResetMs) * time.Millisecond
+}
+
+// NewSlewController limits throttle variations of controller output. Limits are computed from elapsed time between
+// calls, so they don't depend on publish frequency. Output starts from real throttle, or neutral if no feedback is
+// received, after an idle period.
+func NewSlewController(ctrl Controller, cfg *SlewConfig) *SlewController {
+	return &SlewController{
+		ctrl:  ctrl,
+		cfg:   cfg,
+		clock: time.Now,
+	}
+}
+
+type SlewController struct {
+	ctrl  Controller
+	cfg   *SlewConfig
+	clock func() time.Time
+
+	mu           sync.Mutex
+	initialized  bool
+	realThrottle types.Throttle
+	last         types.Throttle
+	lastRate     float64
+	lastTime     time.Time
+}
+
+func (s *SlewController) SetRealThrottle(t types.Throttle) {
+	s.ctrl.SetRealThrottle(t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.realThrottle = t
+}
+
+// Observe records a value published without adjustment as last output
+func (s *SlewController) Observe(t types.Throttle) {
+	if o, ok := s.ctrl.(Observer); ok {
+		o.Observe(t)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialized = true
+	s.update(t, 0., s.clock())
+}
+
+// AdjustEmergencyThrottle returns value without rate limitation, it is recorded as last output
+func (s *SlewController) AdjustEmergencyThrottle(t types.Throttle) types.Throttle {
+	throttle := AdjustEmergencyThrottle(s.ctrl, t)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.initialized = true
+	s.update(throttle, 0., s.clock())
+	return throttle
+}
+
+func (s *SlewController) AdjustThrottle(targetThrottle types.Throttle) types.Throttle {
+	target := s.ctrl.AdjustThrottle(targetThrottle)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	if s.cfg.EmergencyThreshold != nil && target <= *s.cfg.EmergencyThreshold {
+		s.initialized = true
+		s.update(target, 0., now)
+		return target
+	}
+	if !s.initialized || now.Sub(s.lastTime) > s.cfg.idleReset() {
+		// Don't jump to target after an idle period
+		s.initialized = true
+		s.update(s.realThrottle, 0., now)
+		return s.last
+	}
+
+	dt := now.Sub(s.lastTime).Seconds()
+	if dt <= 0. {
+		return s.last
+	}
+
+	rate := float64(target-s.last) / dt
+	if s.cfg.JerkLimit > 0. {
+		rate = clamp(rate, s.lastRate-s.cfg.JerkLimit*dt, s.lastRate+s.cfg.JerkLimit*dt)
+	}
+	rate = clamp(rate, -s.cfg.DecelerationRate, s.cfg.AccelerationRate)
+
+	throttle := s.last + types.Throttle(rate*dt)
+	if (rate > 0. && throttle > target) || (rate < 0. && throttle < target) {
+		// Don't overshoot target when jerk limit keeps previous rate
+		throttle = target
+		rate = float64(target-s.last) / dt
+	}
+	s.update(throttle, rate, now)
+	return throttle
+}
+
+func (s *SlewController) update(throttle types.Throttle, rate float64, now time.Time) {
+	s.last = throttle
+	s.lastRate = rate
+	s.lastTime = now
+}
+
+func clamp(value, min, max float64) float64 {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
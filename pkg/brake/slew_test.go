@@ -0,0 +1,195 @@
+package brake
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSlewController_AdjustThrottle(t *testing.T) {
+	emergency := types.Throttle(-0.8)
+	type step struct {
+		elapsed time.Duration
+		target  types.Throttle
+		want    types.Throttle
+	}
+	tests := []struct {
+		name  string
+		cfg   SlewConfig
+		steps []step
+	}{
+		{
+			name: "acceleration rate",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4.},
+			steps: []step{
+				{target: 0.1, want: 0.1},
+				{elapsed: 100 * time.Millisecond, target: 1., want: 0.3},
+				{elapsed: 100 * time.Millisecond, target: 1., want: 0.5},
+				{elapsed: 50 * time.Millisecond, target: 1., want: 0.6},
+				{elapsed: 500 * time.Millisecond, target: 1., want: 1.},
+			},
+		},
+		{
+			name: "deceleration rate",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4.},
+			steps: []step{
+				{target: 0.8, want: 0.8},
+				{elapsed: 100 * time.Millisecond, target: 0., want: 0.4},
+				{elapsed: 100 * time.Millisecond, target: -0.5, want: 0.},
+			},
+		},
+		{
+			name: "small variation",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4.},
+			steps: []step{
+				{target: 0.5, want: 0.5},
+				{elapsed: 100 * time.Millisecond, target: 0.55, want: 0.55},
+				{elapsed: 100 * time.Millisecond, target: 0.45, want: 0.45},
+			},
+		},
+		{
+			name: "same tick",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4.},
+			steps: []step{
+				{target: 0.1, want: 0.1},
+				{target: 1., want: 0.1},
+			},
+		},
+		{
+			name: "emergency brake",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4., EmergencyThreshold: &emergency},
+			steps: []step{
+				{target: 0.8, want: 0.8},
+				{elapsed: 100 * time.Millisecond, target: -0.5, want: 0.4},
+				{elapsed: 100 * time.Millisecond, target: -1., want: -1.},
+				{elapsed: 100 * time.Millisecond, target: 0., want: -0.8},
+			},
+		},
+		{
+			name: "jerk limit",
+			cfg:  SlewConfig{AccelerationRate: 2., DecelerationRate: 4., JerkLimit: 10.},
+			steps: []step{
+				{target: 0., want: 0.},
+				{elapsed: 100 * time.Millisecond, target: 1., want: 0.1},
+				{elapsed: 100 * time.Millisecond, target: 1., want: 0.3},
+				{elapsed: 100 * time.Millisecond, target: 1., want: 0.5},
+				{elapsed: 100 * time.Millisecond, target: 0.55, want: 0.55},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			s := NewSlewController(&DisabledController{}, &tt.cfg)
+			s.clock = func() time.Time { return now }
+			// Start from first target
+			s.Observe(tt.steps[0].target)
+			for i, st := range tt.steps {
+				now = now.Add(st.elapsed)
+				if got := s.AdjustThrottle(st.target); math.Abs(float64(got-st.want)) > 0.0001 {
+					t.Errorf("step %d: AdjustThrottle() = %v, want %v", i, got, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSlewController_IdleReset(t *testing.T) {
+	now := time.Now()
+	s := NewSlewController(&DisabledController{}, &SlewConfig{AccelerationRate: 2., DecelerationRate: 4.})
+	s.clock = func() time.Time { return now }
+
+	steps := []struct {
+		elapsed      time.Duration
+		realThrottle *types.Throttle
+		target       types.Throttle
+		want         types.Throttle
+	}{
+		// Start from neutral without feedback
+		{target: 0.8, want: 0.},
+		{elapsed: 100 * time.Millisecond, target: 0.8, want: 0.2},
+		{elapsed: 100 * time.Millisecond, target: 0.8, want: 0.4},
+		// Idle period, restart from real throttle
+		{elapsed: 5 * time.Second, realThrottle: throttlePtr(0.1), target: 0.8, want: 0.1},
+		{elapsed: 100 * time.Millisecond, target: 0.8, want: 0.3},
+	}
+	for i, st := range steps {
+		now = now.Add(st.elapsed)
+		if st.realThrottle != nil {
+			s.SetRealThrottle(*st.realThrottle)
+		}
+		if got := s.AdjustThrottle(st.target); math.Abs(float64(got-st.want)) > 0.0001 {
+			t.Errorf("step %d: AdjustThrottle() = %v, want %v", i, got, st.want)
+		}
+	}
+}
+
+func TestSlewController_AdjustEmergencyThrottle(t *testing.T) {
+	now := time.Now()
+	s := NewSlewController(&DisabledController{}, &SlewConfig{AccelerationRate: 1., DecelerationRate: 1.})
+	s.clock = func() time.Time { return now }
+	s.SetRealThrottle(0.3)
+	s.AdjustThrottle(0.3)
+
+	now = now.Add(100 * time.Millisecond)
+	if got := s.AdjustEmergencyThrottle(-1.); got != -1. {
+		t.Errorf("AdjustEmergencyThrottle() = %v, want %v", got, -1.)
+	}
+	// Limiter restarts from emergency value
+	now = now.Add(100 * time.Millisecond)
+	if got := s.AdjustThrottle(0.3); math.Abs(float64(got-(-0.9))) > 0.0001 {
+		t.Errorf("AdjustThrottle() = %v, want %v", got, -0.9)
+	}
+}
+
+func throttlePtr(t types.Throttle) *types.Throttle {
+	return &t
+}
+
+func TestNewSlewConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "valid config",
+			configContent: `{"acceleration_rate": 2.0, "deceleration_rate": 4.0, "jerk_limit": 10.0, "emergency_threshold": -0.8}`,
+		},
+		{
+			name:          "without optional values",
+			configContent: `{"acceleration_rate": 2.0, "deceleration_rate": 4.0}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "acceleration_rate" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "no deceleration rate",
+			configContent: `{"acceleration_rate": 2.0}`,
+			wantErr:       true,
+		},
+		{
+			name:          "positive emergency threshold",
+			configContent: `{"acceleration_rate": 2.0, "deceleration_rate": 4.0, "emergency_threshold": 0.5}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewSlewConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSlewConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
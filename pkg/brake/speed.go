@@ -0,0 +1,120 @@
+package brake
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+// SpeedFeedback is implemented by controllers that use measured speed
+type SpeedFeedback interface {
+	SetSpeed(speed float64)
+}
+
+func NewSpeedConfigFromJson(fileName string) (*SpeedConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg SpeedConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.MaxSpeed <= 0. {
+		return nil, fmt.Errorf("invalid max speed, value must be > 0: %v", cfg.MaxSpeed)
+	}
+	if cfg.AccelerationGain < 0. {
+		return nil, fmt.Errorf("invalid acceleration gain, value must be >= 0: %v", cfg.AccelerationGain)
+	}
+	if cfg.TimeoutMs < 0 {
+		return nil, fmt.Errorf("invalid timeout, value must be >= 0: %v", cfg.TimeoutMs)
+	}
+	if err := cfg.Brake.validate(); err != nil {
+		return nil, fmt.Errorf("invalid brake config %s: %w", fileName, err)
+	}
+	return &cfg, nil
+}
+
+type SpeedConfig struct {
+	// MaxSpeed is the speed in m/s expected with throttle 1.0, target speed is proportional to target throttle
+	MaxSpeed float64 `json:"max_speed"`
+	// AccelerationGain is the throttle added by m/s under target speed
+	AccelerationGain float64 `json:"acceleration_gain"`
+	// Brake values to apply, delta steps are overspeed in m/s
+	Brake Config `json:"brake"`
+	// TimeoutMs, target throttle is returned without adjustment when no speed is received since timeout, disabled if 0
+	TimeoutMs int `json:"timeout_ms,omitempty"`
+}
+
+// NewSpeedController decides brake and acceleration from measured speed instead of throttle feedback
+func NewSpeedController(cfg *SpeedConfig) *SpeedController {
+	return &SpeedController{
+		cfg:   cfg,
+		clock: time.Now,
+	}
+}
+
+type SpeedController struct {
+	cfg   *SpeedConfig
+	clock func() time.Time
+
+	mu        sync.RWMutex
+	speed     float64
+	lastSpeed time.Time
+	stale     bool
+}
+
+// SetRealThrottle is ignored, only measured speed is used
+func (s *SpeedController) SetRealThrottle(_ types.Throttle) {}
+
+func (s *SpeedController) SetSpeed(speed float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speed = speed
+	s.lastSpeed = s.clock()
+}
+
+// currentSpeed returns last measured speed and false if not available
+func (s *SpeedController) currentSpeed() (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stale := s.lastSpeed.IsZero() ||
+		(s.cfg.TimeoutMs > 0 && s.clock().Sub(s.lastSpeed) > time.Duration(s.cfg.TimeoutMs)*time.Millisecond)
+	if stale != s.stale {
+		if stale {
+			zap.S().Warnf("no speed measure available, disable speed controller")
+		} else {
+			zap.S().Infof("speed measure available, enable speed controller")
+		}
+		s.stale = stale
+	}
+	return s.speed, !stale
+}
+
+func (s *SpeedController) AdjustThrottle(targetThrottle types.Throttle) types.Throttle {
+	speed, ok := s.currentSpeed()
+	if !ok || targetThrottle < 0. {
+		return targetThrottle
+	}
+
+	targetSpeed := float64(targetThrottle) * s.cfg.MaxSpeed
+	if speed > targetSpeed {
+		if float32(speed-targetSpeed) < s.cfg.Brake.DeltaSteps[0] {
+			// Small overspeed, no brake needed
+			return targetThrottle
+		}
+		return s.cfg.Brake.ValueOf(types.Throttle(speed), types.Throttle(targetSpeed))
+	}
+
+	throttle := targetThrottle + types.Throttle((targetSpeed-speed)*s.cfg.AccelerationGain)
+	if throttle > 1. {
+		throttle = 1.
+	}
+	return throttle
+}
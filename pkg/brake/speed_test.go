@@ -0,0 +1,147 @@
+package brake
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var speedConfig = SpeedConfig{
+	MaxSpeed:         10.,
+	AccelerationGain: 0.1,
+	Brake: Config{
+		DeltaSteps: []float32{0.5, 2., 4.},
+		Data:       []types.Throttle{-0.1, -0.5, -1.},
+	},
+	TimeoutMs: 200,
+}
+
+func TestSpeedController_AdjustThrottle(t *testing.T) {
+	tests := []struct {
+		name           string
+		noSpeed        bool
+		speed          float64
+		elapsed        time.Duration
+		targetThrottle types.Throttle
+		want           types.Throttle
+	}{
+		{
+			name:           "no speed",
+			noSpeed:        true,
+			targetThrottle: 0.5,
+			want:           0.5,
+		},
+		{
+			name:           "stale speed",
+			speed:          8.,
+			elapsed:        300 * time.Millisecond,
+			targetThrottle: 0.5,
+			want:           0.5,
+		},
+		{
+			name:           "target speed reached",
+			speed:          5.,
+			targetThrottle: 0.5,
+			want:           0.5,
+		},
+		{
+			name:           "under target speed",
+			speed:          3.,
+			targetThrottle: 0.5,
+			want:           0.7,
+		},
+		{
+			name:           "far under target speed",
+			speed:          0.,
+			targetThrottle: 0.9,
+			want:           1.,
+		},
+		{
+			name:           "small overspeed",
+			speed:          5.3,
+			targetThrottle: 0.5,
+			want:           0.5,
+		},
+		{
+			name:           "overspeed",
+			speed:          6.,
+			targetThrottle: 0.5,
+			want:           -0.1,
+		},
+		{
+			name:           "big overspeed",
+			speed:          9.,
+			targetThrottle: 0.5,
+			want:           -1.,
+		},
+		{
+			name:           "brake request",
+			speed:          2.,
+			targetThrottle: -0.3,
+			want:           -0.3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			s := NewSpeedController(&speedConfig)
+			s.clock = func() time.Time { return now }
+			if !tt.noSpeed {
+				s.SetSpeed(tt.speed)
+			}
+			now = now.Add(tt.elapsed)
+			if got := s.AdjustThrottle(tt.targetThrottle); math.Abs(float64(got-tt.want)) > 0.0001 {
+				t.Errorf("AdjustThrottle() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSpeedConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "valid config",
+			configContent: `{"max_speed": 10, "acceleration_gain": 0.1, "brake": {"delta_steps": [0.5, 2, 4], "data": [-0.1, -0.5, -1]}, "timeout_ms": 200}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "max_speed" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "no max speed",
+			configContent: `{"acceleration_gain": 0.1, "brake": {"delta_steps": [0.5], "data": [-0.1]}}`,
+			wantErr:       true,
+		},
+		{
+			name:          "negative gain",
+			configContent: `{"max_speed": 10, "acceleration_gain": -0.1, "brake": {"delta_steps": [0.5], "data": [-0.1]}}`,
+			wantErr:       true,
+		},
+		{
+			name:          "no brake",
+			configContent: `{"max_speed": 10, "acceleration_gain": 0.1}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewSpeedConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSpeedConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
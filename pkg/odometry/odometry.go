@@ -0,0 +1,45 @@
+// Package odometry defines messages published on odometry topic. Payload is json encoded and follows
+// odometry.schema.json:
+//
+//	{"speed": 1.25, "timestamp_ms": 1700000000000}
+package odometry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+type Message struct {
+	// Speed is the measured speed in m/s, negative when car moves backward
+	Speed float64 `json:"speed"`
+	// TimestampMs is the measure time as unix timestamp in milliseconds, optional
+	TimestampMs int64 `json:"timestamp_ms,omitempty"`
+}
+
+// Time returns measure time or zero time if not defined
+func (m *Message) Time() time.Time {
+	if m.TimestampMs == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(m.TimestampMs)
+}
+
+func Unmarshal(payload []byte) (*Message, error) {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json odometry message: %w", err)
+	}
+	if math.IsNaN(msg.Speed) || math.IsInf(msg.Speed, 0) {
+		return nil, fmt.Errorf("invalid speed value: %v", msg.Speed)
+	}
+	if msg.TimestampMs < 0 {
+		return nil, fmt.Errorf("invalid timestamp: %v", msg.TimestampMs)
+	}
+	return &msg, nil
+}
+
+func Marshal(msg *Message) ([]byte, error) {
+	return json.Marshal(msg)
+}
@@ -0,0 +1,67 @@
+package odometry
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    *Message
+		wantErr bool
+	}{
+		{
+			name:    "speed only",
+			payload: `{"speed": 1.25}`,
+			want:    &Message{Speed: 1.25},
+		},
+		{
+			name:    "with timestamp",
+			payload: `{"speed": 1.25, "timestamp_ms": 1700000000000}`,
+			want:    &Message{Speed: 1.25, TimestampMs: 1700000000000},
+		},
+		{
+			name:    "invalid json",
+			payload: `{"speed"}`,
+			wantErr: true,
+		},
+		{
+			name:    "negative timestamp",
+			payload: `{"speed": 1.25, "timestamp_ms": -1}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Unmarshal([]byte(tt.payload))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Unmarshal() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Unmarshal() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	msg := Message{Speed: 2.5, TimestampMs: 1700000000000}
+	payload, err := Marshal(&msg)
+	if err != nil {
+		t.Fatalf("unable to marshal message: %v", err)
+	}
+	got, err := Unmarshal(payload)
+	if err != nil {
+		t.Fatalf("unable to unmarshal message: %v", err)
+	}
+	if *got != msg {
+		t.Errorf("bad message: %v, want %v", got, msg)
+	}
+	if !got.Time().Equal(time.UnixMilli(1700000000000)) {
+		t.Errorf("bad time: %v", got.Time())
+	}
+}
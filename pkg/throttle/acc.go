@@ -0,0 +1,173 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultObjectsTimeout = 1 * time.Second
+
+func NewACCConfigFromJson(fileName string) (*ACCConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg ACCConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.MinConfidence < 0. || cfg.MinConfidence > 1. {
+		return nil, fmt.Errorf("invalid min confidence: 0.0 <= %v <= 1.0", cfg.MinConfidence)
+	}
+	if cfg.LaneLeft < 0. || cfg.LaneRight > 1. || cfg.LaneLeft >= cfg.LaneRight {
+		return nil, fmt.Errorf("invalid lane limits: 0.0 <= %v < %v <= 1.0", cfg.LaneLeft, cfg.LaneRight)
+	}
+	if cfg.DistanceFactor <= 0. || cfg.SpeedFactor <= 0. || cfg.TimeGap <= 0. {
+		return nil, fmt.Errorf("invalid config, distance_factor (%v), speed_factor (%v) and time_gap (%v) must be > 0",
+			cfg.DistanceFactor, cfg.SpeedFactor, cfg.TimeGap)
+	}
+	if cfg.ObjectsTimeoutMs < 0 {
+		return nil, fmt.Errorf("invalid objects timeout, value must be >= 0: %v", cfg.ObjectsTimeoutMs)
+	}
+	if cfg.MinDistance < 0. || cfg.Hysteresis < 0. {
+		return nil, fmt.Errorf("invalid config, min_distance (%v) and hysteresis (%v) must be positive",
+			cfg.MinDistance, cfg.Hysteresis)
+	}
+	return &cfg, nil
+}
+
+type ACCConfig struct {
+	// MinConfidence is the detection confidence under which objects are ignored
+	MinConfidence float32 `json:"min_confidence"`
+	// LaneLeft and LaneRight delimit, in normalized frame coordinates, the horizontal band where cars are in our path
+	LaneLeft  float32 `json:"lane_left"`
+	LaneRight float32 `json:"lane_right"`
+	// DistanceFactor converts normalized bounding box height to distance in meters: distance = factor / height
+	DistanceFactor float64 `json:"distance_factor"`
+	// SpeedFactor is the speed in m/s reached at full throttle
+	SpeedFactor float64 `json:"speed_factor"`
+	// TimeGap to keep with car ahead, in seconds
+	TimeGap float64 `json:"time_gap"`
+	// MinDistance in meters under which throttle is cut
+	MinDistance float64 `json:"min_distance"`
+	// Hysteresis in meters to add to the desired distance before releasing throttle limitation. While engaged,
+	// allowed speed is computed with this margin so that limitation isn't released as soon as desired distance is reached
+	Hysteresis float64 `json:"hysteresis"`
+	// ObjectsTimeoutMs, objects older are ignored, default to 1s
+	ObjectsTimeoutMs int `json:"objects_timeout_ms,omitempty"`
+}
+
+func (c *ACCConfig) objectsTimeout() time.Duration {
+	if c.ObjectsTimeoutMs <= 0 {
+		return defaultObjectsTimeout
+	}
+	return time.Duration(c.ObjectsTimeoutMs) * time.Millisecond
+}
+
+// NewACCLimiter build an adaptive cruise control stage that limits throttle to keep a time gap behind other cars
+func NewACCLimiter(cfg *ACCConfig) *ACCLimiter {
+	return &ACCLimiter{cfg: cfg, clock: time.Now}
+}
+
+type ACCLimiter struct {
+	cfg   *ACCConfig
+	clock func() time.Time
+
+	muObjects       sync.RWMutex
+	objects         *events.ObjectsMessage
+	objectsReceived time.Time
+
+	muEngaged sync.Mutex
+	engaged   bool
+}
+
+func (a *ACCLimiter) SetObjects(objects *events.ObjectsMessage) {
+	a.muObjects.Lock()
+	defer a.muObjects.Unlock()
+	a.objects = objects
+	a.objectsReceived = a.clock()
+}
+
+// Objects returns last objects message or nil if it is older than objects timeout
+func (a *ACCLimiter) Objects() *events.ObjectsMessage {
+	a.muObjects.RLock()
+	defer a.muObjects.RUnlock()
+	if a.objects == nil || a.clock().Sub(a.objectsReceived) > a.cfg.objectsTimeout() {
+		return nil
+	}
+	return a.objects
+}
+
+// Limit throttle to keep time gap with the closest car in our path
+func (a *ACCLimiter) Limit(throttle types.Throttle) types.Throttle {
+	distance, found := a.closestCarDistance()
+
+	a.muEngaged.Lock()
+	defer a.muEngaged.Unlock()
+
+	if !found {
+		if a.engaged {
+			zap.S().Infof("acc: no car ahead, release throttle limitation")
+		}
+		a.engaged = false
+		return throttle
+	}
+
+	desired := a.cfg.MinDistance + a.cfg.TimeGap*float64(throttle)*a.cfg.SpeedFactor
+	if !a.engaged && distance < desired {
+		zap.S().Infof("acc: car ahead at %.2fm (< %.2fm), limit throttle", distance, desired)
+		a.engaged = true
+	} else if a.engaged && distance > desired+a.cfg.Hysteresis {
+		zap.S().Infof("acc: car ahead at %.2fm (> %.2fm), release throttle limitation", distance, desired+a.cfg.Hysteresis)
+		a.engaged = false
+	}
+	if !a.engaged {
+		return throttle
+	}
+
+	// Keep hysteresis margin while engaged, limitation is released smoothly at desired distance + hysteresis and
+	// throttle stays cut until min distance + hysteresis
+	allowedSpeed := math.Max(0., distance-a.cfg.MinDistance-a.cfg.Hysteresis) / a.cfg.TimeGap
+	allowed := types.Throttle(allowedSpeed / a.cfg.SpeedFactor)
+	if allowed < throttle {
+		return allowed
+	}
+	return throttle
+}
+
+func (a *ACCLimiter) closestCarDistance() (float64, bool) {
+	objects := a.Objects()
+	if objects == nil {
+		return 0., false
+	}
+
+	found := false
+	closest := math.MaxFloat64
+	for _, o := range objects.GetObjects() {
+		if o.GetType() != events.TypeObject_CAR || o.GetConfidence() < a.cfg.MinConfidence {
+			continue
+		}
+		// Ignore cars outside our lane
+		if o.GetRight() < a.cfg.LaneLeft || o.GetLeft() > a.cfg.LaneRight {
+			continue
+		}
+		height := float64(o.GetBottom() - o.GetTop())
+		if height <= 0. {
+			continue
+		}
+		distance := a.cfg.DistanceFactor / height
+		if distance < closest {
+			closest = distance
+			found = true
+		}
+	}
+	return closest, found
+}
@@ -0,0 +1,247 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var testACCConfig = ACCConfig{
+	MinConfidence:  0.5,
+	LaneLeft:       0.3,
+	LaneRight:      0.7,
+	DistanceFactor: 0.5,
+	SpeedFactor:    10.,
+	TimeGap:        0.5,
+	MinDistance:    0.5,
+	Hysteresis:     0.5,
+}
+
+func carAt(distance float64, left, right float32) *events.Object {
+	height := float32(testACCConfig.DistanceFactor / distance)
+	return &events.Object{Type: events.TypeObject_CAR, Left: left, Right: right, Top: 0.5, Bottom: 0.5 + height, Confidence: 0.9}
+}
+
+func TestACCLimiter_Limit(t *testing.T) {
+	type args struct {
+		objects  *events.ObjectsMessage
+		throttle types.Throttle
+	}
+	tests := []struct {
+		name string
+		args args
+		want types.Throttle
+	}{
+		{
+			name: "no objects",
+			args: args{objects: nil, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "no car ahead",
+			args: args{objects: &events.ObjectsMessage{}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "far car",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{carAt(5., 0.4, 0.6)}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "close car, limit throttle",
+			// desired = 0.5 + 0.5*0.5*10 = 3m; allowed speed = (2-0.5-0.5)/0.5 = 2m/s => 0.2
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{carAt(2., 0.4, 0.6)}}, throttle: 0.5},
+			want: 0.2,
+		},
+		{
+			name: "car under min distance, cut throttle",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{carAt(0.4, 0.4, 0.6)}}, throttle: 0.5},
+			want: 0.,
+		},
+		{
+			name: "close car in another lane",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{carAt(2., 0.0, 0.2)}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "close car with low confidence",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_CAR, Left: 0.4, Right: 0.6, Top: 0.5, Bottom: 0.75, Confidence: 0.2},
+			}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "close object that is not a car",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Left: 0.4, Right: 0.6, Top: 0.5, Bottom: 0.75, Confidence: 0.9},
+			}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "use closest car",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{carAt(2.5, 0.4, 0.6), carAt(2., 0.4, 0.6)}}, throttle: 0.5},
+			want: 0.2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewACCLimiter(&testACCConfig)
+			a.SetObjects(tt.args.objects)
+			if got := a.Limit(tt.args.throttle); !almostEqual(got, tt.want) {
+				t.Errorf("Limit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestACCLimiter_Hysteresis(t *testing.T) {
+	a := NewACCLimiter(&testACCConfig)
+
+	// desired distance at 0.5 throttle: 3m, released over 3.5m
+	steps := []struct {
+		distance float64
+		want     types.Throttle
+	}{
+		{distance: 3.2, want: 0.5},
+		// allowed speed = (2.9-0.5-0.5)/0.5 = 3.8m/s => 0.38
+		{distance: 2.9, want: 0.38},
+		// Car goes away but distance stays under desired + hysteresis, throttle stays limited
+		{distance: 3.1, want: 0.42},
+		{distance: 2.9, want: 0.38},
+		{distance: 3.1, want: 0.42},
+		{distance: 3.4, want: 0.48},
+		// Released
+		{distance: 3.6, want: 0.5},
+		// Car is not limiting until desired distance
+		{distance: 3.1, want: 0.5},
+	}
+	for idx, s := range steps {
+		a.SetObjects(&events.ObjectsMessage{Objects: []*events.Object{carAt(s.distance, 0.4, 0.6)}})
+		if got := a.Limit(0.5); !almostEqual(got, s.want) {
+			t.Errorf("step %d: Limit() = %v, want %v", idx, got, s.want)
+		}
+	}
+}
+
+func TestACCLimiter_StableAroundThreshold(t *testing.T) {
+	a := NewACCLimiter(&testACCConfig)
+
+	// Distance oscillates around desired distance (3m), throttle must not jump back to target
+	a.SetObjects(&events.ObjectsMessage{Objects: []*events.Object{carAt(2.95, 0.4, 0.6)}})
+	previous := a.Limit(0.5)
+	for i := 0; i < 20; i++ {
+		distance := 3.05
+		if i%2 == 1 {
+			distance = 2.95
+		}
+		a.SetObjects(&events.ObjectsMessage{Objects: []*events.Object{carAt(distance, 0.4, 0.6)}})
+		got := a.Limit(0.5)
+		if got >= 0.5 {
+			t.Errorf("step %d: throttle limitation released at %vm", i, distance)
+		}
+		if math.Abs(float64(got-previous)) > 0.025 {
+			t.Errorf("step %d: unstable throttle %v -> %v", i, previous, got)
+		}
+		previous = got
+	}
+}
+
+func TestACCLimiter_MinDistance(t *testing.T) {
+	a := NewACCLimiter(&testACCConfig)
+
+	steps := []struct {
+		distance float64
+		want     types.Throttle
+	}{
+		{distance: 0.4, want: 0.},
+		// Throttle stays cut until min distance + hysteresis
+		{distance: 0.6, want: 0.},
+		{distance: 0.9, want: 0.},
+		{distance: 1.5, want: 0.1},
+	}
+	for idx, s := range steps {
+		a.SetObjects(&events.ObjectsMessage{Objects: []*events.Object{carAt(s.distance, 0.4, 0.6)}})
+		if got := a.Limit(0.5); !almostEqual(got, s.want) {
+			t.Errorf("step %d: Limit() = %v, want %v", idx, got, s.want)
+		}
+	}
+}
+
+func TestACCLimiter_ObjectsTimeout(t *testing.T) {
+	now := time.Now()
+	a := NewACCLimiter(&testACCConfig)
+	a.clock = func() time.Time { return now }
+
+	a.SetObjects(&events.ObjectsMessage{Objects: []*events.Object{carAt(2., 0.4, 0.6)}})
+	now = now.Add(500 * time.Millisecond)
+	if got := a.Limit(0.5); !almostEqual(got, 0.2) {
+		t.Errorf("Limit() = %v, want %v", got, 0.2)
+	}
+	now = now.Add(time.Second)
+	if got := a.Limit(0.5); !almostEqual(got, 0.5) {
+		t.Errorf("stale objects should be ignored, Limit() = %v, want %v", got, 0.5)
+	}
+}
+
+func TestNewACCConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name: "default",
+			configContent: `{
+	"min_confidence": 0.5,
+	"lane_left": 0.3,
+	"lane_right": 0.7,
+	"distance_factor": 0.5,
+	"speed_factor": 10.0,
+	"time_gap": 0.5,
+	"min_distance": 0.5,
+	"hysteresis": 0.5
+}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "min_confidence" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "bad lane",
+			configContent: `{"lane_left": 0.7, "lane_right": 0.3, "distance_factor": 0.5, "speed_factor": 10.0, "time_gap": 0.5}`,
+			wantErr:       true,
+		},
+		{
+			name:          "missing time gap",
+			configContent: `{"lane_left": 0.3, "lane_right": 0.7, "distance_factor": 0.5, "speed_factor": 10.0}`,
+			wantErr:       true,
+		},
+		{
+			name:          "negative hysteresis",
+			configContent: `{"lane_left": 0.3, "lane_right": 0.7, "distance_factor": 0.5, "speed_factor": 10.0, "time_gap": 0.5, "hysteresis": -1}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			got, err := NewACCConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewACCConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && *got != testACCConfig {
+				t.Errorf("NewACCConfigFromJson() got = %v, want %v", *got, testACCConfig)
+			}
+		})
+	}
+}
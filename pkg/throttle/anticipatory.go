@@ -0,0 +1,223 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+func NewAnticipatoryConfigFromJson(fileName string) (*AnticipatoryConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg AnticipatoryConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.WindowMs <= 0 {
+		return nil, fmt.Errorf("invalid window, value must be > 0: %v", cfg.WindowMs)
+	}
+	if cfg.RateGain < 0. || cfg.AccelerationGain < 0. || cfg.ExitGain < 0. {
+		return nil, fmt.Errorf("invalid gains, values must be positive: rate=%v, acceleration=%v, exit=%v",
+			cfg.RateGain, cfg.AccelerationGain, cfg.ExitGain)
+	}
+	if cfg.MaxCut < 0. || cfg.MaxBoost < 0. {
+		return nil, fmt.Errorf("invalid limits, values must be positive: max_cut=%v, max_boost=%v", cfg.MaxCut, cfg.MaxBoost)
+	}
+	if cfg.MinThrottle < 0. || cfg.MaxThrottle > 1. || cfg.MinThrottle >= cfg.MaxThrottle {
+		return nil, fmt.Errorf("invalid throttle limits: 0.0 <= %v < %v <= 1.0", cfg.MinThrottle, cfg.MaxThrottle)
+	}
+	if cfg.Timestamp != "" {
+		if _, err := NewSteeringTimestamp(string(cfg.Timestamp)); err != nil {
+			return nil, err
+		}
+	}
+	return &cfg, nil
+}
+
+type AnticipatoryConfig struct {
+	// WindowMs is the duration of steering history used to compute steering rate and acceleration
+	WindowMs int `json:"window_ms"`
+	// RateGain is the throttle cut by unit of steering rate (1/s) when entering a corner
+	RateGain float64 `json:"rate_gain"`
+	// AccelerationGain is the throttle cut by unit of steering acceleration (1/s²) when entering a corner
+	AccelerationGain float64 `json:"acceleration_gain"`
+	// ExitGain is the throttle boost by unit of steering rate (1/s) when exiting a corner
+	ExitGain    float64        `json:"exit_gain"`
+	MaxCut      types.Throttle `json:"max_cut"`
+	MaxBoost    types.Throttle `json:"max_boost"`
+	MinThrottle types.Throttle `json:"min_throttle"`
+	MaxThrottle types.Throttle `json:"max_throttle"`
+	// Timestamp of steering samples, receipt (default) or frame time
+	Timestamp SteeringTimestamp `json:"timestamp,omitempty"`
+}
+
+// SteeringRecorder is implemented by processors that need each received steering, not only steering at tick time
+type SteeringRecorder interface {
+	RecordSteering(msg *events.SteeringMessage)
+}
+
+type steeringSample struct {
+	at       time.Time
+	steering float64
+}
+
+// NewAnticipatoryProcessor build a processor that adjusts base throttle from steering rate of change:
+// throttle is cut when a corner starts and restored early on corner exit. Steering history is fed by RecordSteering on
+// each steering message.
+func NewAnticipatoryProcessor(base Processor, cfg *AnticipatoryConfig) *AnticipatoryProcessor {
+	return &AnticipatoryProcessor{
+		base:    base,
+		cfg:     cfg,
+		clock:   time.Now,
+		samples: make([]steeringSample, 0),
+	}
+}
+
+type AnticipatoryProcessor struct {
+	base  Processor
+	cfg   *AnticipatoryConfig
+	clock func() time.Time
+
+	muSamples sync.Mutex
+	samples   []steeringSample
+}
+
+func (a *AnticipatoryProcessor) SetSpeedZone(sz events.SpeedZone) {
+	a.base.SetSpeedZone(sz)
+}
+
+func (a *AnticipatoryProcessor) SetRoad(road *events.RoadMessage) {
+	if rp, ok := a.base.(RoadProcessor); ok {
+		rp.SetRoad(road)
+	}
+}
+
+func (a *AnticipatoryProcessor) SetRealThrottle(t types.Throttle) {
+	if fp, ok := a.base.(FeedbackProcessor); ok {
+		fp.SetRealThrottle(t)
+	}
+}
+
+func (a *AnticipatoryProcessor) SetDriveMode(dm events.DriveMode) {
+	if dp, ok := a.base.(DriveModeProcessor); ok {
+		dp.SetDriveMode(dm)
+	}
+}
+
+// RecordSteering adds steering to history, at receipt time or frame time regarding config. Frame time is never after
+// receipt time. Samples older than last one are ignored.
+func (a *AnticipatoryProcessor) RecordSteering(msg *events.SteeringMessage) {
+	if sr, ok := a.base.(SteeringRecorder); ok {
+		sr.RecordSteering(msg)
+	}
+
+	now := a.clock()
+	at := now
+	if a.cfg.Timestamp == SteeringTimestampFrame && msg.GetFrameRef().GetCreatedAt() != nil {
+		if frameTime := msg.GetFrameRef().GetCreatedAt().AsTime(); frameTime.Before(at) {
+			at = frameTime
+		}
+	}
+
+	a.muSamples.Lock()
+	defer a.muSamples.Unlock()
+	// Process isn't called out of PILOT mode, history must be bounded here too
+	a.trim(now)
+	if len(a.samples) > 0 && at.Before(a.samples[len(a.samples)-1].at) {
+		return
+	}
+	a.samples = append(a.samples, steeringSample{at: at, steering: math.Abs(float64(msg.GetSteering()))})
+}
+
+// Process compute throttle from steering value and variations of steering recorded in window
+func (a *AnticipatoryProcessor) Process(steering types.Steering) types.Throttle {
+	throttle := a.base.Process(steering)
+
+	rate, acceleration := a.derivatives()
+	adjust := types.Throttle(0.)
+	if rate > 0. {
+		cut := types.Throttle(a.cfg.RateGain*rate + a.cfg.AccelerationGain*math.Max(acceleration, 0.))
+		if cut > a.cfg.MaxCut {
+			cut = a.cfg.MaxCut
+		}
+		adjust = -cut
+	} else if rate < 0. {
+		boost := types.Throttle(a.cfg.ExitGain * -rate)
+		if boost > a.cfg.MaxBoost {
+			boost = a.cfg.MaxBoost
+		}
+		adjust = boost
+	}
+
+	throttle += adjust
+	if throttle < a.cfg.MinThrottle {
+		return a.cfg.MinThrottle
+	}
+	if throttle > a.cfg.MaxThrottle {
+		return a.cfg.MaxThrottle
+	}
+	return throttle
+}
+
+// derivatives drops samples out of window and returns rate and acceleration of absolute steering
+func (a *AnticipatoryProcessor) derivatives() (float64, float64) {
+	a.muSamples.Lock()
+	defer a.muSamples.Unlock()
+
+	a.trim(a.clock())
+	return steeringDerivatives(a.samples)
+}
+
+// trim drops samples older than window, muSamples lock must be held
+func (a *AnticipatoryProcessor) trim(now time.Time) {
+	limit := now.Add(-1 * time.Duration(a.cfg.WindowMs) * time.Millisecond)
+	idx := 0
+	for idx < len(a.samples) && a.samples[idx].at.Before(limit) {
+		idx++
+	}
+	a.samples = a.samples[idx:]
+}
+
+// steeringDerivatives fits a quadratic curve on samples and returns first and second derivatives at last sample
+func steeringDerivatives(samples []steeringSample) (float64, float64) {
+	if len(samples) < 2 {
+		return 0., 0.
+	}
+	last := samples[len(samples)-1].at
+	if len(samples) == 2 {
+		dt := last.Sub(samples[0].at).Seconds()
+		if dt <= 0. {
+			return 0., 0.
+		}
+		return (samples[1].steering - samples[0].steering) / dt, 0.
+	}
+
+	// Least squares on s = c0 + c1*t + c2*t², with t relative to last sample
+	var s0, s1, s2, s3, s4, y0, y1, y2 float64
+	for _, smp := range samples {
+		t := smp.at.Sub(last).Seconds()
+		s0 += 1
+		s1 += t
+		s2 += t * t
+		s3 += t * t * t
+		s4 += t * t * t * t
+		y0 += smp.steering
+		y1 += t * smp.steering
+		y2 += t * t * smp.steering
+	}
+	det := s0*(s2*s4-s3*s3) - s1*(s1*s4-s3*s2) + s2*(s1*s3-s2*s2)
+	if math.Abs(det) < 1e-12 {
+		return 0., 0.
+	}
+	c1 := (s0*(y1*s4-s3*y2) - y0*(s1*s4-s3*s2) + s2*(s1*y2-y1*s2)) / det
+	c2 := (s0*(s2*y2-y1*s3) - s1*(s1*y2-y1*s2) + y0*(s1*s3-s2*s2)) / det
+	return c1, 2 * c2
+}
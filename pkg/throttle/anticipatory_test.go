@@ -0,0 +1,321 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-base/testtools"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAnticipatoryProcessor_Process(t *testing.T) {
+	cfg := AnticipatoryConfig{
+		WindowMs:         500,
+		RateGain:         0.2,
+		AccelerationGain: 0.05,
+		ExitGain:         0.1,
+		MaxCut:           0.3,
+		MaxBoost:         0.1,
+		MinThrottle:      0.1,
+		MaxThrottle:      0.8,
+	}
+	type args struct {
+		steerings []types.Steering
+		period    time.Duration
+	}
+	tests := []struct {
+		name string
+		args args
+		want types.Throttle
+	}{
+		{
+			name: "straight line, no change",
+			args: args{steerings: []types.Steering{0., 0., 0., 0.}, period: 100 * time.Millisecond},
+			want: 0.5,
+		},
+		{
+			name: "stable corner, no change",
+			args: args{steerings: []types.Steering{0.5, 0.5, 0.5, 0.5}, period: 100 * time.Millisecond},
+			want: 0.25,
+		},
+		{
+			name: "corner start, cut throttle",
+			args: args{steerings: []types.Steering{0., 0.05, 0.1, 0.15}, period: 100 * time.Millisecond},
+			want: 0.325,
+		},
+		{
+			name: "corner start on left, cut throttle",
+			args: args{steerings: []types.Steering{0., -0.05, -0.1, -0.15}, period: 100 * time.Millisecond},
+			want: 0.325,
+		},
+		{
+			name: "brutal corner start, cut limited",
+			args: args{steerings: []types.Steering{0., 0.2, 0.4, 0.6}, period: 100 * time.Millisecond},
+			want: 0.1,
+		},
+		{
+			name: "corner exit, boost throttle",
+			args: args{steerings: []types.Steering{0.6, 0.5, 0.4, 0.3}, period: 100 * time.Millisecond},
+			want: 0.45,
+		},
+		{
+			name: "old samples out of window are ignored",
+			args: args{steerings: []types.Steering{0.8, 0.5, 0.5, 0.5}, period: 300 * time.Millisecond},
+			want: 0.25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			a := NewAnticipatoryProcessor(NewSteeringProcessor(0., 0.5), &cfg)
+			a.clock = func() time.Time { return now }
+
+			for idx, s := range tt.args.steerings {
+				if idx > 0 {
+					now = now.Add(tt.args.period)
+				}
+				a.RecordSteering(&events.SteeringMessage{Steering: float32(s), Confidence: 1.})
+			}
+			got := a.Process(tt.args.steerings[len(tt.args.steerings)-1])
+			if !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnticipatoryProcessor_RecordSteering(t *testing.T) {
+	cfg := AnticipatoryConfig{
+		WindowMs:    200,
+		RateGain:    0.2,
+		MaxCut:      0.3,
+		MaxBoost:    0.1,
+		MinThrottle: 0.,
+		MaxThrottle: 0.8,
+	}
+	frameCfg := cfg
+	frameCfg.Timestamp = SteeringTimestampFrame
+
+	// steering received every 50ms, frames are 100ms old
+	frameDelay := 100 * time.Millisecond
+	tests := []struct {
+		name      string
+		cfg       *AnticipatoryConfig
+		frameTime func(receipt time.Time, idx int) time.Time
+		tickDelay time.Duration
+		want      types.Throttle
+	}{
+		{
+			// base throttle 0.25, rate = 0.05/0.05s = 1/s => cut 0.2
+			name:      "window shorter than tick period, receipt time",
+			cfg:       &cfg,
+			frameTime: func(receipt time.Time, _ int) time.Time { return receipt.Add(-frameDelay) },
+			want:      0.05,
+		},
+		{
+			name:      "frame time",
+			cfg:       &frameCfg,
+			frameTime: func(receipt time.Time, idx int) time.Time { return receipt.Add(-frameDelay * time.Duration(idx%2)) },
+			// Frames alternate between 0 and 100ms delay, delayed ones are out of order and ignored:
+			// rate = 0.1/0.1s = 1/s
+			want: 0.05,
+		},
+		{
+			name:      "frame in the future",
+			cfg:       &frameCfg,
+			frameTime: func(receipt time.Time, _ int) time.Time { return receipt.Add(time.Hour) },
+			want:      0.05,
+		},
+		{
+			name:      "no recent steering",
+			cfg:       &cfg,
+			frameTime: func(receipt time.Time, _ int) time.Time { return receipt },
+			tickDelay: 500 * time.Millisecond,
+			want:      0.25,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			a := NewAnticipatoryProcessor(NewSteeringProcessor(0., 0.5), tt.cfg)
+			a.clock = func() time.Time { return now }
+
+			steering := float32(0.)
+			for idx := 0; idx < 10; idx++ {
+				now = now.Add(50 * time.Millisecond)
+				steering += 0.05
+				a.RecordSteering(&events.SteeringMessage{
+					Steering:   steering,
+					Confidence: 1.,
+					FrameRef:   &events.FrameRef{CreatedAt: timestamppb.New(tt.frameTime(now, idx))},
+				})
+			}
+			now = now.Add(tt.tickDelay)
+			if got := a.Process(types.Steering(steering)); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAnticipatoryProcessor_RecordSteeringWindow(t *testing.T) {
+	now := time.Now()
+	a := NewAnticipatoryProcessor(NewSteeringProcessor(0., 0.5), &AnticipatoryConfig{WindowMs: 200, MaxThrottle: 0.8})
+	a.clock = func() time.Time { return now }
+
+	// Process isn't called out of PILOT mode
+	for i := 0; i < 1000; i++ {
+		now = now.Add(10 * time.Millisecond)
+		a.RecordSteering(&events.SteeringMessage{Steering: 0.5, Confidence: 1.})
+	}
+
+	a.muSamples.Lock()
+	defer a.muSamples.Unlock()
+	if len(a.samples) > 21 {
+		t.Errorf("samples out of window should be dropped: %v samples", len(a.samples))
+	}
+}
+
+func TestController_SteeringRecorder(t *testing.T) {
+	cfg := AnticipatoryConfig{WindowMs: 200, RateGain: 0.2, MaxCut: 0.3, MinThrottle: 0., MaxThrottle: 0.8}
+	a := NewAnticipatoryProcessor(NewSteeringProcessor(0., 0.5), &cfg)
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 2,
+		WithThrottleProcessor(NewLapLearningProcessor(a, &LapConfig{})),
+	)
+	for i := 0; i < 3; i++ {
+		c.onSteering(nil, testtools.NewFakeMessageFromProtobuf("topic/steering", &events.SteeringMessage{Steering: 0.5, Confidence: 1.}))
+	}
+
+	a.muSamples.Lock()
+	defer a.muSamples.Unlock()
+	if len(a.samples) != 3 {
+		t.Errorf("each steering message should be recorded: %v samples, want %v", len(a.samples), 3)
+	}
+}
+
+func TestSteeringDerivatives(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name             string
+		f                func(t float64) float64
+		samples          int
+		wantRate         float64
+		wantAcceleration float64
+	}{
+		{name: "constant", f: func(t float64) float64 { return 0.3 }, samples: 5},
+		{name: "one sample", f: func(t float64) float64 { return 0.3 }, samples: 1},
+		{name: "linear", f: func(t float64) float64 { return 0.1 + 0.5*t }, samples: 5, wantRate: 0.5},
+		{name: "linear, 2 samples", f: func(t float64) float64 { return 0.1 + 0.5*t }, samples: 2, wantRate: 0.5},
+		// s(t) = 2t², at t=0.4: rate = 4t = 1.6, acceleration = 4
+		{name: "quadratic", f: func(t float64) float64 { return 2 * t * t }, samples: 5, wantRate: 1.6, wantAcceleration: 4.},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples := make([]steeringSample, 0, tt.samples)
+			for i := 0; i < tt.samples; i++ {
+				x := float64(i) * 0.1
+				samples = append(samples, steeringSample{
+					at:       now.Add(time.Duration(i) * 100 * time.Millisecond),
+					steering: tt.f(x),
+				})
+			}
+			rate, acceleration := steeringDerivatives(samples)
+			if math.Abs(rate-tt.wantRate) > 0.0001 {
+				t.Errorf("steeringDerivatives() rate = %v, want %v", rate, tt.wantRate)
+			}
+			if math.Abs(acceleration-tt.wantAcceleration) > 0.0001 {
+				t.Errorf("steeringDerivatives() acceleration = %v, want %v", acceleration, tt.wantAcceleration)
+			}
+		})
+	}
+}
+
+func TestNewAnticipatoryConfigFromJson(t *testing.T) {
+	type args struct {
+		configContent string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    *AnticipatoryConfig
+		wantErr bool
+	}{
+		{
+			name: "default",
+			args: args{
+				configContent: `{
+	"window_ms": 500,
+	"rate_gain": 0.2,
+	"acceleration_gain": 0.05,
+	"exit_gain": 0.1,
+	"max_cut": 0.3,
+	"max_boost": 0.1,
+	"min_throttle": 0.1,
+	"max_throttle": 0.8
+}
+`,
+			},
+			want: &AnticipatoryConfig{WindowMs: 500, RateGain: 0.2, AccelerationGain: 0.05, ExitGain: 0.1,
+				MaxCut: 0.3, MaxBoost: 0.1, MinThrottle: 0.1, MaxThrottle: 0.8},
+		},
+		{
+			name:    "invalid config",
+			args:    args{configContent: `{ "window_ms" }`},
+			wantErr: true,
+		},
+		{
+			name:    "missing window",
+			args:    args{configContent: `{"rate_gain": 0.2, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+		{
+			name:    "negative gain",
+			args:    args{configContent: `{"window_ms": 500, "rate_gain": -0.2, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+		{
+			name:    "negative limit",
+			args:    args{configContent: `{"window_ms": 500, "max_cut": -0.2, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+		{
+			name:    "bad throttle limits",
+			args:    args{configContent: `{"window_ms": 500, "min_throttle": 0.8, "max_throttle": 0.1}`},
+			wantErr: true,
+		},
+		{
+			name: "frame timestamp",
+			args: args{configContent: `{"window_ms": 500, "min_throttle": 0.1, "max_throttle": 0.8, "timestamp": "frame"}`},
+			want: &AnticipatoryConfig{WindowMs: 500, MinThrottle: 0.1, MaxThrottle: 0.8, Timestamp: SteeringTimestampFrame},
+		},
+		{
+			name:    "bad timestamp",
+			args:    args{configContent: `{"window_ms": 500, "min_throttle": 0.1, "max_throttle": 0.8, "timestamp": "tick"}`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.args.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			got, err := NewAnticipatoryConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewAnticipatoryConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewAnticipatoryConfigFromJson() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
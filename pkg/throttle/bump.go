@@ -0,0 +1,118 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+func NewSpeedBumpConfigFromJson(fileName string) (*SpeedBumpConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg SpeedBumpConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.MinConfidence < 0. || cfg.MinConfidence > 1. {
+		return nil, fmt.Errorf("invalid min confidence: 0.0 <= %v <= 1.0", cfg.MinConfidence)
+	}
+	if cfg.MinBottom < 0. || cfg.MinBottom > 1. {
+		return nil, fmt.Errorf("invalid min bottom: 0.0 <= %v <= 1.0", cfg.MinBottom)
+	}
+	if cfg.CrossingThrottle <= 0. || cfg.CrossingThrottle > 1. {
+		return nil, fmt.Errorf("invalid crossing throttle: 0.0 < %v <= 1.0", cfg.CrossingThrottle)
+	}
+	if cfg.HoldMs <= 0 && cfg.CrossingDistance <= 0. {
+		return nil, fmt.Errorf("invalid config, hold_ms or crossing_distance must be set")
+	}
+	if cfg.CrossingDistance > 0. && cfg.SpeedFactor <= 0. {
+		return nil, fmt.Errorf("invalid config, speed_factor must be > 0 when crossing_distance is set: %v", cfg.SpeedFactor)
+	}
+	return &cfg, nil
+}
+
+type SpeedBumpConfig struct {
+	// MinConfidence is the detection confidence under which bumps are ignored
+	MinConfidence float32 `json:"min_confidence"`
+	// MinBottom is the normalized vertical position the bump bottom must reach to slow down
+	MinBottom float32 `json:"min_bottom"`
+	// CrossingThrottle is the max throttle allowed to cross the bump
+	CrossingThrottle types.Throttle `json:"crossing_throttle"`
+	// HoldMs is the duration to keep crossing throttle after last detection
+	HoldMs int `json:"hold_ms,omitempty"`
+	// CrossingDistance in meters to drive at crossing throttle after last detection, used instead of HoldMs if set
+	CrossingDistance float64 `json:"crossing_distance,omitempty"`
+	// SpeedFactor is the speed in m/s reached at full throttle, used to convert CrossingDistance to duration
+	SpeedFactor float64 `json:"speed_factor,omitempty"`
+}
+
+// holdDuration returns how long crossing throttle is applied after bump detection
+func (c *SpeedBumpConfig) holdDuration() time.Duration {
+	if c.CrossingDistance > 0. {
+		seconds := c.CrossingDistance / (float64(c.CrossingThrottle) * c.SpeedFactor)
+		return time.Duration(seconds * float64(time.Second))
+	}
+	return time.Duration(c.HoldMs) * time.Millisecond
+}
+
+// NewSpeedBumpLimiter build a stage that caps throttle when a speed bump is detected ahead
+func NewSpeedBumpLimiter(cfg *SpeedBumpConfig) *SpeedBumpLimiter {
+	return &SpeedBumpLimiter{
+		cfg:   cfg,
+		clock: time.Now,
+	}
+}
+
+type SpeedBumpLimiter struct {
+	cfg   *SpeedBumpConfig
+	clock func() time.Time
+
+	muUntil sync.Mutex
+	until   time.Time
+	active  bool
+}
+
+func (s *SpeedBumpLimiter) SetObjects(objects *events.ObjectsMessage) {
+	for _, o := range objects.GetObjects() {
+		if o.GetType() != events.TypeObject_BUMP || o.GetConfidence() < s.cfg.MinConfidence {
+			continue
+		}
+		if o.GetBottom() < s.cfg.MinBottom {
+			continue
+		}
+
+		s.muUntil.Lock()
+		s.until = s.clock().Add(s.cfg.holdDuration())
+		s.muUntil.Unlock()
+		return
+	}
+}
+
+// Limit throttle to crossing throttle while a bump is close
+func (s *SpeedBumpLimiter) Limit(throttle types.Throttle) types.Throttle {
+	s.muUntil.Lock()
+	defer s.muUntil.Unlock()
+
+	active := s.clock().Before(s.until)
+	if active != s.active {
+		if active {
+			zap.S().Infof("speed bump detected, limit throttle to %v", s.cfg.CrossingThrottle)
+		} else {
+			zap.S().Infof("speed bump crossed, resume normal throttle")
+		}
+		s.active = active
+	}
+
+	if active && throttle > s.cfg.CrossingThrottle {
+		return s.cfg.CrossingThrottle
+	}
+	return throttle
+}
@@ -0,0 +1,171 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSpeedBumpLimiter_Limit(t *testing.T) {
+	cfg := SpeedBumpConfig{
+		MinConfidence:    0.5,
+		MinBottom:        0.6,
+		CrossingThrottle: 0.2,
+		HoldMs:           1000,
+	}
+	type args struct {
+		objects  *events.ObjectsMessage
+		elapsed  time.Duration
+		throttle types.Throttle
+	}
+	tests := []struct {
+		name string
+		args args
+		want types.Throttle
+	}{
+		{
+			name: "no object",
+			args: args{objects: &events.ObjectsMessage{}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "close bump",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Top: 0.6, Bottom: 0.7, Confidence: 0.9},
+			}}, throttle: 0.5},
+			want: 0.2,
+		},
+		{
+			name: "close bump, throttle already low",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Top: 0.6, Bottom: 0.7, Confidence: 0.9},
+			}}, throttle: 0.1},
+			want: 0.1,
+		},
+		{
+			name: "bump crossed",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Top: 0.6, Bottom: 0.7, Confidence: 0.9},
+			}}, elapsed: 1100 * time.Millisecond, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "far bump",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Top: 0.3, Bottom: 0.4, Confidence: 0.9},
+			}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "bump with low confidence",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_BUMP, Top: 0.6, Bottom: 0.7, Confidence: 0.3},
+			}}, throttle: 0.5},
+			want: 0.5,
+		},
+		{
+			name: "close car",
+			args: args{objects: &events.ObjectsMessage{Objects: []*events.Object{
+				{Type: events.TypeObject_CAR, Top: 0.6, Bottom: 0.7, Confidence: 0.9},
+			}}, throttle: 0.5},
+			want: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			s := NewSpeedBumpLimiter(&cfg)
+			s.clock = func() time.Time { return now }
+
+			s.SetObjects(tt.args.objects)
+			now = now.Add(tt.args.elapsed)
+			if got := s.Limit(tt.args.throttle); got != tt.want {
+				t.Errorf("Limit() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedBumpConfig_holdDuration(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  SpeedBumpConfig
+		want time.Duration
+	}{
+		{
+			name: "time based",
+			cfg:  SpeedBumpConfig{CrossingThrottle: 0.2, HoldMs: 500},
+			want: 500 * time.Millisecond,
+		},
+		{
+			name: "distance based",
+			cfg:  SpeedBumpConfig{CrossingThrottle: 0.2, HoldMs: 500, CrossingDistance: 1., SpeedFactor: 10.},
+			want: 500 * time.Millisecond,
+		},
+		{
+			name: "distance based, slow crossing",
+			cfg:  SpeedBumpConfig{CrossingThrottle: 0.1, CrossingDistance: 1., SpeedFactor: 10.},
+			want: 1 * time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.holdDuration(); (got - tt.want).Abs() > time.Millisecond {
+				t.Errorf("holdDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewSpeedBumpConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "time based",
+			configContent: `{"min_confidence": 0.5, "min_bottom": 0.6, "crossing_throttle": 0.2, "hold_ms": 1000}`,
+		},
+		{
+			name:          "distance based",
+			configContent: `{"min_confidence": 0.5, "min_bottom": 0.6, "crossing_throttle": 0.2, "crossing_distance": 0.5, "speed_factor": 10.0}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "min_confidence" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "no duration",
+			configContent: `{"min_confidence": 0.5, "min_bottom": 0.6, "crossing_throttle": 0.2}`,
+			wantErr:       true,
+		},
+		{
+			name:          "distance without speed factor",
+			configContent: `{"min_confidence": 0.5, "min_bottom": 0.6, "crossing_throttle": 0.2, "crossing_distance": 0.5}`,
+			wantErr:       true,
+		},
+		{
+			name:          "bad crossing throttle",
+			configContent: `{"min_confidence": 0.5, "min_bottom": 0.6, "crossing_throttle": 1.2, "hold_ms": 1000}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewSpeedBumpConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSpeedBumpConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
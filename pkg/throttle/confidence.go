@@ -0,0 +1,76 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+)
+
+func NewConfidenceCurveFromJson(fileName string) (*ConfidenceCurve, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cc ConfidenceCurve
+	err = json.Unmarshal(content, &cc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if len(cc.ConfidenceValues) == 0 {
+		return nil, fmt.Errorf("invalid configuration, none confidence value")
+	}
+	if len(cc.ConfidenceValues) != len(cc.Factors) {
+		return nil, fmt.Errorf("invalid config, confidence value number must be equals "+
+			"to factor number: %v/%v", len(cc.ConfidenceValues), len(cc.Factors))
+	}
+	lastC := float32(-0.001)
+	for _, c := range cc.ConfidenceValues {
+		if c < 0. || c > 1. {
+			return nil, fmt.Errorf("invalid confidence value: 0.0 <= %v <= 1.0", c)
+		}
+		if c <= lastC {
+			return nil, fmt.Errorf("invalid confidence value, all values must be increasing: %v <= %v", lastC, c)
+		}
+		lastC = c
+	}
+	lastF := float32(0.)
+	for _, f := range cc.Factors {
+		if f < 0. || f > 1. {
+			return nil, fmt.Errorf("invalid factor value: 0.0 <= %v <= 1.0", f)
+		}
+		if f < lastF {
+			return nil, fmt.Errorf("invalid factor value, all values must be increasing: %v < %v", f, lastF)
+		}
+		lastF = f
+	}
+	return &cc, nil
+}
+
+// ConfidenceCurve maps autopilot confidence to a throttle factor, factor is linearly interpolated between points
+type ConfidenceCurve struct {
+	ConfidenceValues []float32 `json:"confidence_values"`
+	Factors          []float32 `json:"factors"`
+}
+
+func (cc *ConfidenceCurve) FactorOf(confidence float32) float32 {
+	if confidence <= cc.ConfidenceValues[0] {
+		return cc.Factors[0]
+	}
+	for i := 1; i < len(cc.ConfidenceValues); i++ {
+		if confidence < cc.ConfidenceValues[i] {
+			c0, c1 := cc.ConfidenceValues[i-1], cc.ConfidenceValues[i]
+			f0, f1 := cc.Factors[i-1], cc.Factors[i]
+			return f0 + (f1-f0)*(confidence-c0)/(c1-c0)
+		}
+	}
+	return cc.Factors[len(cc.Factors)-1]
+}
+
+// Scale reduces positive throttle regarding confidence, brake values are kept unchanged
+func (cc *ConfidenceCurve) Scale(throttle types.Throttle, confidence float32) types.Throttle {
+	if throttle <= 0. {
+		return throttle
+	}
+	return throttle * types.Throttle(cc.FactorOf(confidence))
+}
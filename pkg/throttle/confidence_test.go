@@ -0,0 +1,101 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestConfidenceCurve_Scale(t *testing.T) {
+	cc := ConfidenceCurve{
+		ConfidenceValues: []float32{0.2, 0.6, 0.9},
+		Factors:          []float32{0.0, 0.5, 1.0},
+	}
+	type args struct {
+		throttle   types.Throttle
+		confidence float32
+	}
+	tests := []struct {
+		name string
+		args args
+		want types.Throttle
+	}{
+		{name: "full confidence", args: args{throttle: 0.6, confidence: 1.0}, want: 0.6},
+		{name: "confidence on last point", args: args{throttle: 0.6, confidence: 0.9}, want: 0.6},
+		{name: "confidence on intermediate point", args: args{throttle: 0.6, confidence: 0.6}, want: 0.3},
+		{name: "confidence between points", args: args{throttle: 0.6, confidence: 0.4}, want: 0.15},
+		{name: "confidence under first point", args: args{throttle: 0.6, confidence: 0.1}, want: 0.},
+		{name: "brake is not scaled", args: args{throttle: -0.5, confidence: 0.1}, want: -0.5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cc.Scale(tt.args.throttle, tt.args.confidence); !almostEqual(got, tt.want) {
+				t.Errorf("Scale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConfidenceCurveFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		want          *ConfidenceCurve
+		wantErr       bool
+	}{
+		{
+			name:          "default",
+			configContent: `{"confidence_values": [0.2, 0.6, 0.9], "factors": [0.0, 0.5, 1.0]}`,
+			want:          &ConfidenceCurve{ConfidenceValues: []float32{0.2, 0.6, 0.9}, Factors: []float32{0.0, 0.5, 1.0}},
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "confidence_values" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "empty config",
+			configContent: `{"confidence_values": [], "factors": []}`,
+			wantErr:       true,
+		},
+		{
+			name:          "incoherent config",
+			configContent: `{"confidence_values": [0.2, 0.6, 0.9], "factors": [0.0, 1.0]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "confidence in bad order",
+			configContent: `{"confidence_values": [0.6, 0.2, 0.9], "factors": [0.0, 0.5, 1.0]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "factor in bad order",
+			configContent: `{"confidence_values": [0.2, 0.6, 0.9], "factors": [0.5, 0.0, 1.0]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "factor > 1",
+			configContent: `{"confidence_values": [0.2, 0.6, 0.9], "factors": [0.0, 0.5, 1.5]}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			got, err := NewConfidenceCurveFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewConfidenceCurveFromJson() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewConfidenceCurveFromJson() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,9 +1,11 @@
 package throttle
 
 import (
+	"fmt"
 	"github.com/cyrilix/robocar-base/service"
 	"github.com/cyrilix/robocar-protobuf/go/events"
 	"github.com/cyrilix/robocar-throttle/pkg/brake"
+	"github.com/cyrilix/robocar-throttle/pkg/odometry"
 	"github.com/cyrilix/robocar-throttle/pkg/types"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"go.uber.org/zap"
@@ -29,6 +31,10 @@ func New(client mqtt.Client, throttleTopic, driveModeTopic, rcThrottleTopic, ste
 		publishPilotFrequency: publishPilotFrequency,
 		processor:             &SteeringProcessor{minThrottle: 0.1, maxThrottle: maxValue},
 		brakeCtrl:             &brake.DisabledController{},
+		steeringConfidence:    1.0,
+		speedZoneConfidence:   1.0,
+		copilotStrategy:       CopilotRC,
+		copilotBlendWeight:    0.5,
 	}
 	for _, o := range opts {
 		o(c)
@@ -44,31 +50,122 @@ func WithBrakeController(bc brake.Controller) Option {
 	}
 }
 
+// WithOutputController adjusts published throttle of autopilot, copilot, failsafe, dead-man and transitions. Safety
+// values (failsafe, dead-man release and transitions) are adjusted with brake.AdjustEmergencyThrottle, so they aren't
+// rate limited. RC throttle on USER mode and emergency stop values are published unchanged and only observed if
+// controller is a brake.Observer.
+func WithOutputController(oc brake.Controller) Option {
+	return func(c *Controller) {
+		c.output = oc
+	}
+}
+
 func WithThrottleProcessor(p Processor) Option {
 	return func(c *Controller) {
 		c.processor = p
 	}
 }
 
+// WithConfidenceCurve scales PILOT throttle with autopilot confidence
+func WithConfidenceCurve(cc *ConfidenceCurve) Option {
+	return func(c *Controller) {
+		c.confidenceCurve = cc
+	}
+}
+
+// WithLimiter adds a stage applied, in order, to processor throttle on PILOT and COPILOT modes
+func WithLimiter(l Limiter) Option {
+	return func(c *Controller) {
+		c.limiters = append(c.limiters, l)
+	}
+}
+
+// WithObjectsTopic subscribes to objects detection events, objects are forwarded to processor and limiters
+// if they are ObjectsProcessor
+func WithObjectsTopic(topic string) Option {
+	return func(c *Controller) {
+		c.objectsTopic = topic
+	}
+}
+
+// WithLapTopic subscribes to lap line events, each message notifies processor, if it is a LapProcessor, that car
+// starts a new lap. Message content is ignored.
+func WithLapTopic(topic string) Option {
+	return func(c *Controller) {
+		c.lapTopic = topic
+	}
+}
+
+// WithStartSequencer holds neutral on PILOT mode until a message is received on start topic, then applies launch
+// profile before handing over to processor. Message content is ignored.
+func WithStartSequencer(topic string, s *StartSequencer) Option {
+	return func(c *Controller) {
+		c.startTopic = topic
+		c.startSequencer = s
+	}
+}
+
+// WithRoadTopic subscribes to road detection events, road is forwarded to processor if it is a RoadProcessor
+func WithRoadTopic(topic string) Option {
+	return func(c *Controller) {
+		c.roadTopic = topic
+	}
+}
+
+// WithOdometryTopic subscribes to odometry events, measured speed is forwarded to brake controller if it is a
+// brake.SpeedFeedback. Payload is json encoded, see odometry package.
+func WithOdometryTopic(topic string) Option {
+	return func(c *Controller) {
+		c.odometryTopic = topic
+	}
+}
+
 type Controller struct {
 	client        mqtt.Client
 	throttleTopic string
 	maxThrottle   types.Throttle
 	processor     Processor
+	limiters      []Limiter
 
 	muDriveMode sync.RWMutex
 	driveMode   events.DriveMode
 
-	muSteering sync.RWMutex
-	steering   types.Steering
+	muSteering         sync.RWMutex
+	steering           types.Steering
+	steeringConfidence float32
+
+	muSpeedZoneConfidence sync.RWMutex
+	speedZoneConfidence   float32
+	confidenceCurve       *ConfidenceCurve
 
 	brakeCtrl brake.Controller
+	output    brake.Controller
+
+	startSequencer *StartSequencer
+
+	copilotStrategy    CopilotStrategy
+	copilotBlendWeight float64
+	muCopilot          sync.RWMutex
+	copilotTarget      types.Throttle
+	copilotReady       bool
+
+	deadMan          *deadMan
+	steeringWatchdog *steeringWatchdog
+	transitions      *transitions
+	eStop            *eStop
 
 	cancel                                                                chan interface{}
 	publishPilotFrequency                                                 int
 	driveModeTopic, rcThrottleTopic, steeringTopic, throttleFeedbackTopic string
 	maxThrottleCtrlTopic                                                  string
 	speedZoneTopic                                                        string
+	roadTopic                                                             string
+	objectsTopic                                                          string
+	lapTopic                                                              string
+	startTopic                                                            string
+	odometryTopic                                                         string
+	statusTopic                                                           string
+	eStopTopic                                                            string
 }
 
 func (c *Controller) Start() error {
@@ -90,18 +187,93 @@ func (c *Controller) Start() error {
 }
 
 func (c *Controller) onPublishPilotValue() {
+	latched, unlock := c.rLockEStop()
+	defer unlock()
+	if latched {
+		throttle, _ := c.eStop.throttle()
+		c.publishObservedThrottle(throttle, 1.)
+		return
+	}
+	if c.publishTransitionThrottle() {
+		return
+	}
+
 	c.muDriveMode.RLock()
 	defer c.muDriveMode.RUnlock()
 
+	if c.driveMode == events.DriveMode_COPILOT {
+		c.updateCopilotTarget()
+		return
+	}
 	if c.driveMode != events.DriveMode_PILOT {
 		return
 	}
 
+	if c.deadMan != nil && !c.deadMan.Held() {
+		c.publishEmergencyThrottle(c.deadMan.release, c.readConfidence())
+		return
+	}
+
+	if c.steeringWatchdog != nil {
+		expired, changed := c.steeringWatchdog.Expired()
+		if changed && expired {
+			c.publishStatus("steering_watchdog", "expired",
+				fmt.Sprintf("no steering since %v, %v failsafe", c.steeringWatchdog.timeout,
+					c.steeringWatchdog.failsafe.Mode))
+		} else if changed {
+			c.publishStatus("steering_watchdog", "ok", "fresh steering received")
+		}
+		if expired {
+			c.publishEmergencyThrottle(c.steeringWatchdog.failsafe.Throttle, 0.)
+			return
+		}
+	}
+
 	throttleFromSteering := c.processor.Process(c.readSteering())
+	for _, l := range c.limiters {
+		throttleFromSteering = l.Limit(throttleFromSteering)
+	}
+	confidence := c.readConfidence()
+	if c.confidenceCurve != nil {
+		throttleFromSteering = c.confidenceCurve.Scale(throttleFromSteering, confidence)
+	}
+	if c.startSequencer != nil {
+		throttleFromSteering = c.startSequencer.Throttle(throttleFromSteering)
+	}
+	if c.transitions != nil {
+		throttleFromSteering = c.transitions.SoftStart(throttleFromSteering)
+	}
 
+	c.publishThrottle(c.brakeCtrl.AdjustThrottle(throttleFromSteering), confidence)
+}
+
+func (c *Controller) publishThrottle(throttle types.Throttle, confidence float32) {
+	if c.output != nil {
+		throttle = c.output.AdjustThrottle(throttle)
+	}
+	c.publishRawThrottle(throttle, confidence)
+}
+
+// publishEmergencyThrottle publishes a safety value, output controller can't delay it
+func (c *Controller) publishEmergencyThrottle(throttle types.Throttle, confidence float32) {
+	if c.output != nil {
+		throttle = brake.AdjustEmergencyThrottle(c.output, throttle)
+	}
+	c.publishRawThrottle(throttle, confidence)
+}
+
+// publishObservedThrottle publishes throttle unchanged, output controller only tracks it
+func (c *Controller) publishObservedThrottle(throttle types.Throttle, confidence float32) {
+	if o, ok := c.output.(brake.Observer); ok {
+		o.Observe(throttle)
+	}
+	c.publishRawThrottle(throttle, confidence)
+}
+
+func (c *Controller) publishRawThrottle(throttle types.Throttle, confidence float32) {
 	throttleMsg := events.ThrottleMessage{
-		Throttle:   float32(c.brakeCtrl.AdjustThrottle(throttleFromSteering)),
-		Confidence: 1.0,
+		Throttle:   float32(throttle),
+		Confidence: confidence,
 	}
 	payload, err := proto.Marshal(&throttleMsg)
 	if err != nil {
@@ -110,7 +282,6 @@ func (c *Controller) onPublishPilotValue() {
 	}
 
 	publish(c.client, c.throttleTopic, payload)
-
 }
 
 func (c *Controller) readSteering() types.Steering {
@@ -119,10 +290,32 @@ func (c *Controller) readSteering() types.Steering {
 	return c.steering
 }
 
+// readConfidence returns combined confidence of autopilot inputs
+func (c *Controller) readConfidence() float32 {
+	c.muSteering.RLock()
+	steeringConfidence := c.steeringConfidence
+	c.muSteering.RUnlock()
+
+	c.muSpeedZoneConfidence.RLock()
+	defer c.muSpeedZoneConfidence.RUnlock()
+	return steeringConfidence * c.speedZoneConfidence
+}
+
 func (c *Controller) Stop() {
 	close(c.cancel)
-	service.StopService("throttle", c.client, c.driveModeTopic, c.rcThrottleTopic, c.steeringTopic,
-		c.throttleFeedbackTopic, c.maxThrottleCtrlTopic, c.speedZoneTopic)
+	service.StopService("throttle", c.client, c.topics()...)
+}
+
+func (c *Controller) topics() []string {
+	topics := []string{c.driveModeTopic, c.rcThrottleTopic, c.steeringTopic, c.throttleFeedbackTopic,
+		c.maxThrottleCtrlTopic, c.speedZoneTopic}
+	for _, t := range []string{c.roadTopic, c.objectsTopic, c.lapTopic, c.startTopic, c.odometryTopic,
+		c.eStopTopic} {
+		if t != "" {
+			topics = append(topics, t)
+		}
+	}
+	return topics
 }
 
 func (c *Controller) onThrottleFeedback(_ mqtt.Client, message mqtt.Message) {
@@ -133,6 +326,15 @@ func (c *Controller) onThrottleFeedback(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 	c.brakeCtrl.SetRealThrottle(types.Throttle(msg.GetThrottle()))
+	if c.output != nil {
+		c.output.SetRealThrottle(types.Throttle(msg.GetThrottle()))
+	}
+	if fp, ok := c.processor.(FeedbackProcessor); ok {
+		fp.SetRealThrottle(types.Throttle(msg.GetThrottle()))
+	}
+	if c.startSequencer != nil {
+		c.startSequencer.SetRealThrottle(types.Throttle(msg.GetThrottle()))
+	}
 }
 
 func (c *Controller) onMaxThrottleCtrl(_ mqtt.Client, message mqtt.Message) {
@@ -155,14 +357,49 @@ func (c *Controller) onDriveMode(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 
+	// Lock emergency stop first, as publish callbacks do
+	latched, unlock := c.rLockEStop()
+	defer unlock()
+
 	c.muDriveMode.Lock()
 	defer c.muDriveMode.Unlock()
+	previous := c.driveMode
 	c.driveMode = msg.GetDriveMode()
+	if previous != c.driveMode {
+		c.resetCopilotTarget()
+		c.onDriveModeChange(previous, c.driveMode, latched)
+	}
+	if dp, ok := c.processor.(DriveModeProcessor); ok {
+		dp.SetDriveMode(c.driveMode)
+	}
+	if c.startSequencer != nil {
+		c.startSequencer.SetDriveMode(c.driveMode)
+	}
 }
 
 func (c *Controller) onRCThrottle(_ mqtt.Client, message mqtt.Message) {
+	released := false
+	if c.deadMan != nil {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(message.Payload(), &msg); err != nil {
+			zap.S().Errorf("unable to unmarshal protobuf %T message: %v", &msg, err)
+			return
+		}
+		released = c.deadMan.SetTrigger(types.Throttle(msg.GetThrottle()))
+	}
+	latched, unlock := c.rLockEStop()
+	defer unlock()
+	if latched {
+		return
+	}
+
 	c.muDriveMode.RLock()
 	defer c.muDriveMode.RUnlock()
+	if released && c.driveMode == events.DriveMode_PILOT {
+		// Don't wait next tick
+		c.publishEmergencyThrottle(c.deadMan.release, c.readConfidence())
+		return
+	}
 	if c.driveMode == events.DriveMode_USER || c.driveMode == events.DriveMode_COPILOT {
 		// Republish same content
 		payload := message.Payload()
@@ -172,12 +409,30 @@ func (c *Controller) onRCThrottle(_ mqtt.Client, message mqtt.Message) {
 			zap.S().Errorf("unable to unmarshall throttle msg to check throttle value: %v", err)
 			return
 		}
+		if c.transitions != nil && c.transitions.Holding() {
+			if throttleMsg.GetThrottle() == 0. {
+				// Keep transition throttle until user takes control
+				return
+			}
+			c.transitions.Cancel()
+		}
 		zap.S().Debugf("publish new throttle value from rc: %v", throttleMsg.GetThrottle())
 
-		if types.Throttle(throttleMsg.GetThrottle()) > 0. {
-			maxTh := c.maxThrottle
-			current := types.Throttle(throttleMsg.GetThrottle())
-			throttleMsg.Throttle = float32(current * maxTh)
+		current := types.Throttle(throttleMsg.GetThrottle())
+		throttle := current
+		if throttle > 0. {
+			throttle = current * c.maxThrottle
+		}
+		if c.driveMode == events.DriveMode_COPILOT {
+			throttle = c.copilotThrottle(throttle)
+			if c.output != nil {
+				throttle = c.output.AdjustThrottle(throttle)
+			}
+		} else if o, ok := c.output.(brake.Observer); ok {
+			o.Observe(throttle)
+		}
+		if throttle != current {
+			throttleMsg.Throttle = float32(throttle)
 			payloadPatched, err := proto.Marshal(&throttleMsg)
 			if err != nil {
 				zap.S().Errorf("unable to marshall throttle msg: %v", err)
@@ -198,9 +453,16 @@ func (c *Controller) onSteering(_ mqtt.Client, message mqtt.Message) {
 		zap.S().Errorf("unable to unmarshal steering message, skip value: %v", err)
 		return
 	}
+	if c.steeringWatchdog != nil {
+		c.steeringWatchdog.Feed(&steeringMsg)
+	}
+	if sr, ok := c.processor.(SteeringRecorder); ok {
+		sr.RecordSteering(&steeringMsg)
+	}
 	c.muSteering.Lock()
 	defer c.muSteering.Unlock()
 	c.steering = types.Steering(steeringMsg.GetSteering())
+	c.steeringConfidence = steeringMsg.GetConfidence()
 }
 
 func (c *Controller) onSpeedZone(_ mqtt.Client, message mqtt.Message) {
@@ -212,6 +474,64 @@ func (c *Controller) onSpeedZone(_ mqtt.Client, message mqtt.Message) {
 		return
 	}
 	c.processor.SetSpeedZone(szMsg.GetSpeedZone())
+
+	c.muSpeedZoneConfidence.Lock()
+	defer c.muSpeedZoneConfidence.Unlock()
+	c.speedZoneConfidence = szMsg.GetConfidence()
+}
+
+func (c *Controller) onRoad(_ mqtt.Client, message mqtt.Message) {
+	var roadMsg events.RoadMessage
+	payload := message.Payload()
+	err := proto.Unmarshal(payload, &roadMsg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal road message, skip value: %v", err)
+		return
+	}
+	if rp, ok := c.processor.(RoadProcessor); ok {
+		rp.SetRoad(&roadMsg)
+	}
+}
+
+func (c *Controller) onObjects(_ mqtt.Client, message mqtt.Message) {
+	var objectsMsg events.ObjectsMessage
+	payload := message.Payload()
+	err := proto.Unmarshal(payload, &objectsMsg)
+	if err != nil {
+		zap.S().Errorf("unable to unmarshal objects message, skip value: %v", err)
+		return
+	}
+	if op, ok := c.processor.(ObjectsProcessor); ok {
+		op.SetObjects(&objectsMsg)
+	}
+	for _, l := range c.limiters {
+		if op, ok := l.(ObjectsProcessor); ok {
+			op.SetObjects(&objectsMsg)
+		}
+	}
+}
+
+func (c *Controller) onStart(_ mqtt.Client, _ mqtt.Message) {
+	if c.startSequencer != nil {
+		c.startSequencer.Go()
+	}
+}
+
+func (c *Controller) onOdometry(_ mqtt.Client, message mqtt.Message) {
+	msg, err := odometry.Unmarshal(message.Payload())
+	if err != nil {
+		zap.S().Errorf("unable to read odometry message: %v", err)
+		return
+	}
+	if sf, ok := c.brakeCtrl.(brake.SpeedFeedback); ok {
+		sf.SetSpeed(msg.Speed)
+	}
+}
+
+func (c *Controller) onLap(_ mqtt.Client, _ mqtt.Message) {
+	if lp, ok := c.processor.(LapProcessor); ok {
+		lp.NewLap()
+	}
 }
 
 var registerCallbacks = func(p *Controller) error {
@@ -241,9 +561,49 @@ var registerCallbacks = func(p *Controller) error {
 	if err != nil {
 		return err
 	}
+	if p.roadTopic != "" {
+		err = service.RegisterCallback(p.client, p.roadTopic, p.onRoad)
+		if err != nil {
+			return err
+		}
+	}
+	if p.objectsTopic != "" {
+		err = service.RegisterCallback(p.client, p.objectsTopic, p.onObjects)
+		if err != nil {
+			return err
+		}
+	}
+	if p.lapTopic != "" {
+		err = service.RegisterCallback(p.client, p.lapTopic, p.onLap)
+		if err != nil {
+			return err
+		}
+	}
+	if p.startTopic != "" {
+		err = service.RegisterCallback(p.client, p.startTopic, p.onStart)
+		if err != nil {
+			return err
+		}
+	}
+	if p.eStopTopic != "" {
+		err = service.RegisterCallback(p.client, p.eStopTopic, p.onEStop)
+		if err != nil {
+			return err
+		}
+	}
+	if p.odometryTopic != "" {
+		err = service.RegisterCallback(p.client, p.odometryTopic, p.onOdometry)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 var publish = func(client mqtt.Client, topic string, payload []byte) {
 	client.Publish(topic, 0, false, payload)
 }
+
+var publishRetained = func(client mqtt.Client, topic string, payload []byte) {
+	client.Publish(topic, 1, true, payload)
+}
@@ -1,12 +1,14 @@
 package throttle
 
 import (
+	"encoding/json"
 	"github.com/cyrilix/robocar-base/testtools"
 	"github.com/cyrilix/robocar-protobuf/go/events"
 	"github.com/cyrilix/robocar-throttle/pkg/brake"
 	"github.com/cyrilix/robocar-throttle/pkg/types"
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 	"google.golang.org/protobuf/proto"
+	"math"
 	"sync"
 	"testing"
 	"time"
@@ -426,3 +428,950 @@ func TestController_Start(t *testing.T) {
 		})
 	}
 }
+
+func TestController_onRoad(t *testing.T) {
+	roadProcessor := NewRoadGeometryProcessor(NewSteeringProcessor(0.1, 0.5), &testRoadConfig)
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(roadProcessor),
+		WithRoadTopic("topic/road"),
+	)
+
+	road := events.RoadMessage{
+		Contour: []*events.Point{{X: 20, Y: 120}, {X: 60, Y: 0}, {X: 100, Y: 120}},
+		Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 60}, Width: 40, Height: 120, Confidence: 0.9},
+	}
+	c.onRoad(nil, testtools.NewFakeMessageFromProtobuf("topic/road", &road))
+
+	if got := roadProcessor.Road(); !proto.Equal(got, &road) {
+		t.Errorf("road not forwarded to processor: %v, want %v", got, &road)
+	}
+	if topics := c.topics(); topics[len(topics)-1] != "topic/road" {
+		t.Errorf("road topic should be unsubscribed on stop: %v", topics)
+	}
+}
+
+type fixedLimiter struct {
+	max     types.Throttle
+	objects *events.ObjectsMessage
+}
+
+func (f *fixedLimiter) Limit(throttle types.Throttle) types.Throttle {
+	if throttle > f.max {
+		return f.max
+	}
+	return throttle
+}
+
+func (f *fixedLimiter) SetObjects(objects *events.ObjectsMessage) {
+	f.objects = objects
+}
+
+func TestController_Limiters(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+
+	l1 := &fixedLimiter{max: 0.6}
+	l2 := &fixedLimiter{max: 0.4}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithLimiter(l1),
+		WithLimiter(l2),
+		WithObjectsTopic("topic/objects"),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+
+	objects := events.ObjectsMessage{Objects: []*events.Object{{Type: events.TypeObject_CAR, Confidence: 0.9}}}
+	c.onObjects(nil, testtools.NewFakeMessageFromProtobuf("topic/objects", &objects))
+	if !proto.Equal(l1.objects, &objects) || !proto.Equal(l2.objects, &objects) {
+		t.Errorf("objects not forwarded to limiters")
+	}
+
+	c.onPublishPilotValue()
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(published, &msg); err != nil {
+		t.Fatalf("unable to unmarshall response: %v", err)
+	}
+	if msg.GetThrottle() != 0.4 {
+		t.Errorf("throttle should be limited by all limiters: %v, want %v", msg.GetThrottle(), 0.4)
+	}
+}
+
+func TestController_Confidence(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+
+	tests := []struct {
+		name                string
+		curve               *ConfidenceCurve
+		steeringConfidence  float32
+		speedZoneConfidence *float32
+		want                *events.ThrottleMessage
+	}{
+		{
+			name:               "no curve, confidence is only published",
+			steeringConfidence: 0.5,
+			want:               &events.ThrottleMessage{Throttle: 0.8, Confidence: 0.5},
+		},
+		{
+			name:               "scale throttle with steering confidence",
+			curve:              &ConfidenceCurve{ConfidenceValues: []float32{0., 1.}, Factors: []float32{0., 1.}},
+			steeringConfidence: 0.5,
+			want:               &events.ThrottleMessage{Throttle: 0.4, Confidence: 0.5},
+		},
+		{
+			name:                "combine steering and speed zone confidences",
+			curve:               &ConfidenceCurve{ConfidenceValues: []float32{0., 1.}, Factors: []float32{0., 1.}},
+			steeringConfidence:  0.5,
+			speedZoneConfidence: func() *float32 { c := float32(0.5); return &c }(),
+			want:                &events.ThrottleMessage{Throttle: 0.2, Confidence: 0.25},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8))}
+			if tt.curve != nil {
+				opts = append(opts, WithConfidenceCurve(tt.curve))
+			}
+			c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+				"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10, opts...)
+			c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+			c.onSteering(nil, testtools.NewFakeMessageFromProtobuf("topic/steering", &events.SteeringMessage{Steering: 0., Confidence: tt.steeringConfidence}))
+			if tt.speedZoneConfidence != nil {
+				c.onSpeedZone(nil, testtools.NewFakeMessageFromProtobuf("topic/speedZone", &events.SpeedZoneMessage{SpeedZone: events.SpeedZone_FAST, Confidence: *tt.speedZoneConfidence}))
+			}
+
+			c.onPublishPilotValue()
+			var msg events.ThrottleMessage
+			if err := proto.Unmarshal(published, &msg); err != nil {
+				t.Fatalf("unable to unmarshall response: %v", err)
+			}
+			if !almostEqual(types.Throttle(msg.GetThrottle()), types.Throttle(tt.want.GetThrottle())) {
+				t.Errorf("bad throttle: %v, want %v", msg.GetThrottle(), tt.want.GetThrottle())
+			}
+			if msg.GetConfidence() != tt.want.GetConfidence() {
+				t.Errorf("bad confidence: %v, want %v", msg.GetConfidence(), tt.want.GetConfidence())
+			}
+		})
+	}
+}
+
+type lapCounter struct {
+	SteeringProcessor
+	laps int
+}
+
+func (l *lapCounter) NewLap() {
+	l.laps++
+}
+
+func TestController_onLap(t *testing.T) {
+	p := &lapCounter{}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(p),
+		WithLapTopic("topic/lap"),
+	)
+	c.onLap(nil, testtools.NewFakeMessage("topic/lap", []byte{}))
+	c.onLap(nil, testtools.NewFakeMessage("topic/lap", []byte{}))
+	if p.laps != 2 {
+		t.Errorf("bad laps number: %v, want %v", p.laps, 2)
+	}
+}
+
+func TestController_StartSequencer(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+
+	now := time.Now()
+	s := NewStartSequencer(&StartConfig{Profile: LaunchRamp, DurationMs: 1000})
+	s.clock = func() time.Time { return now }
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithStartSequencer("topic/start", s),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0. {
+		t.Errorf("throttle should be neutral before go signal: %v", got)
+	}
+
+	c.onStart(nil, testtools.NewFakeMessage("topic/start", []byte{}))
+	now = now.Add(500 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); !almostEqual(types.Throttle(got), 0.4) {
+		t.Errorf("bad launch throttle: %v, want %v", got, 0.4)
+	}
+
+	now = now.Add(time.Second)
+	c.onPublishPilotValue()
+	if got := readThrottle(); !almostEqual(types.Throttle(got), 0.8) {
+		t.Errorf("processor should drive after launch: %v, want %v", got, 0.8)
+	}
+}
+
+type driveModeRecorder struct {
+	SteeringProcessor
+	driveMode events.DriveMode
+}
+
+func (d *driveModeRecorder) SetDriveMode(dm events.DriveMode) {
+	d.driveMode = dm
+}
+
+func TestController_onDriveModeForwardToProcessor(t *testing.T) {
+	p := &driveModeRecorder{}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(p),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	if p.driveMode != events.DriveMode_PILOT {
+		t.Errorf("drive mode not forwarded to processor: %v, want %v", p.driveMode, events.DriveMode_PILOT)
+	}
+}
+
+func TestController_Copilot(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+
+	// With 0.5 steering, processor throttle is 0.45
+	steering := events.SteeringMessage{Steering: 0.5, Confidence: 1.0}
+
+	tests := []struct {
+		name         string
+		strategy     CopilotStrategy
+		realThrottle types.Throttle
+		rcThrottle   float32
+		noTick       bool
+		limit        types.Throttle
+		want         float32
+	}{
+		{name: "rc strategy", strategy: CopilotRC, rcThrottle: 0.7, want: 0.7},
+		{name: "cap strategy, user above processor", strategy: CopilotCap, rcThrottle: 0.7, want: 0.45},
+		{name: "cap strategy, user below processor", strategy: CopilotCap, rcThrottle: 0.3, want: 0.3},
+		{name: "cap strategy, user brakes", strategy: CopilotCap, rcThrottle: -0.5, want: -0.5},
+		{name: "blend strategy", strategy: CopilotBlend, rcThrottle: 0.7, want: 0.575},
+		{name: "blend strategy, user releases throttle", strategy: CopilotBlend, rcThrottle: 0., want: 0.},
+		{name: "brake strategy, user above processor", strategy: CopilotBrake, realThrottle: 0.8, rcThrottle: 0.7, want: -0.5},
+		{name: "brake strategy, user below processor", strategy: CopilotBrake, realThrottle: 0.8, rcThrottle: 0.3, want: 0.3},
+		{name: "cap strategy, no processor throttle before tick", strategy: CopilotCap, noTick: true, rcThrottle: 0.7, want: 0.7},
+		{name: "cap strategy, limiters applied", strategy: CopilotCap, limit: 0.2, rcThrottle: 0.7, want: 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			brakeCtrl := brake.NewCustomController()
+			limiters := []Option{}
+			if tt.limit > 0. {
+				limiters = append(limiters, WithLimiter(&fixedLimiter{max: tt.limit}))
+			}
+			c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+				"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+				WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+				WithBrakeController(brakeCtrl),
+				WithCopilotStrategy(tt.strategy),
+				WithCopilotBlendWeight(0.5),
+			)
+			for _, o := range limiters {
+				o(c)
+			}
+			c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_COPILOT}))
+			c.onSteering(nil, testtools.NewFakeMessageFromProtobuf("topic/steering", &steering))
+			c.onThrottleFeedback(nil, testtools.NewFakeMessageFromProtobuf("topic/feedback/throttle", &events.ThrottleMessage{Throttle: float32(tt.realThrottle)}))
+			if !tt.noTick {
+				c.onPublishPilotValue()
+			}
+
+			c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: tt.rcThrottle, Confidence: 1.0}))
+
+			var msg events.ThrottleMessage
+			if err := proto.Unmarshal(published, &msg); err != nil {
+				t.Fatalf("unable to unmarshall response: %v", err)
+			}
+			if !almostEqual(types.Throttle(msg.GetThrottle()), types.Throttle(tt.want)) {
+				t.Errorf("bad throttle: %v, want %v", msg.GetThrottle(), tt.want)
+			}
+		})
+	}
+}
+
+type countingProcessor struct {
+	SteeringProcessor
+	calls int
+}
+
+func (p *countingProcessor) Process(steering types.Steering) types.Throttle {
+	p.calls += 1
+	return p.SteeringProcessor.Process(steering)
+}
+
+func TestController_CopilotProcessorCalledOnTick(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	publish = func(client mqtt.Client, topic string, payload []byte) {}
+
+	p := &countingProcessor{SteeringProcessor: *NewSteeringProcessor(0.1, 0.8)}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(p),
+		WithCopilotStrategy(CopilotCap),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_COPILOT}))
+	c.onPublishPilotValue()
+	for i := 0; i < 5; i++ {
+		c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.7, Confidence: 1.0}))
+	}
+	if p.calls != 1 {
+		t.Errorf("processor called %v times, want 1 call by tick", p.calls)
+	}
+}
+
+func TestController_DeadMan(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	now := time.Now()
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithDeadMan(0.2, 500*time.Millisecond, -0.1),
+	)
+	c.deadMan.clock = func() time.Time { return now }
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.1 {
+		t.Errorf("release throttle should be published without rc message: %v, want %v", got, -0.1)
+	}
+
+	published = nil
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+	if published != nil {
+		t.Errorf("rc throttle should not be published on pilot mode")
+	}
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.8 {
+		t.Errorf("autopilot throttle should be published while trigger is held: %v, want %v", got, 0.8)
+	}
+
+	now = now.Add(time.Second)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.1 {
+		t.Errorf("release throttle should be published on rc timeout: %v, want %v", got, -0.1)
+	}
+
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.8 {
+		t.Errorf("autopilot throttle should be published while trigger is held: %v, want %v", got, 0.8)
+	}
+
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.}))
+	if got := readThrottle(); got != -0.1 {
+		t.Errorf("release throttle should be published as soon as trigger is released: %v, want %v", got, -0.1)
+	}
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.1 {
+		t.Errorf("release throttle should be published when trigger is released: %v, want %v", got, -0.1)
+	}
+}
+
+type speedRecorder struct {
+	brake.DisabledController
+	speed float64
+}
+
+func (s *speedRecorder) SetSpeed(speed float64) {
+	s.speed = speed
+}
+
+func TestController_onOdometry(t *testing.T) {
+	bc := &speedRecorder{}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithBrakeController(bc),
+		WithOdometryTopic("topic/odometry"),
+	)
+	c.onOdometry(nil, testtools.NewFakeMessage("topic/odometry", []byte(`{"speed": 2.5}`)))
+	if bc.speed != 2.5 {
+		t.Errorf("bad speed: %v, want %v", bc.speed, 2.5)
+	}
+	c.onOdometry(nil, testtools.NewFakeMessage("topic/odometry", []byte(`{"speed"}`)))
+	if bc.speed != 2.5 {
+		t.Errorf("invalid message should be ignored, speed: %v, want %v", bc.speed, 2.5)
+	}
+}
+
+func TestController_SteeringWatchdog(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	var statuses []StatusEvent
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		if topic == "topic/status" {
+			var event StatusEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Fatalf("unable to unmarshal status event: %v", err)
+			}
+			statuses = append(statuses, event)
+			return
+		}
+		published = payload
+	}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	now := time.Now()
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithSteeringWatchdog(200*time.Millisecond, SteeringTimestampReceipt, &Failsafe{Mode: FailsafeBrake, Throttle: -0.2}),
+		WithStatusTopic("topic/status"),
+	)
+	c.steeringWatchdog.clock = func() time.Time { return now }
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	statuses = nil
+
+	c.onSteering(nil, testtools.NewFakeMessageFromProtobuf("topic/steering", &events.SteeringMessage{Steering: 0., Confidence: 1.}))
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.8 {
+		t.Errorf("autopilot throttle should be published on fresh steering: %v, want %v", got, 0.8)
+	}
+
+	now = now.Add(300 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.2 {
+		t.Errorf("failsafe throttle should be published on steering timeout: %v, want %v", got, -0.2)
+	}
+	c.onPublishPilotValue()
+	if len(statuses) != 1 || statuses[0].Component != "steering_watchdog" || statuses[0].State != "expired" {
+		t.Errorf("one expired status event should be published: %v", statuses)
+	}
+
+	c.onSteering(nil, testtools.NewFakeMessageFromProtobuf("topic/steering", &events.SteeringMessage{Steering: 0., Confidence: 1.}))
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.8 {
+		t.Errorf("autopilot throttle should be published on fresh steering: %v, want %v", got, 0.8)
+	}
+	if len(statuses) != 2 || statuses[1].State != "ok" {
+		t.Errorf("ok status event should be published: %v", statuses)
+	}
+}
+
+func TestController_DriveModeTransitions(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	var statuses []StatusEvent
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		if topic == "topic/status" {
+			var event StatusEvent
+			if err := json.Unmarshal(payload, &event); err != nil {
+				t.Fatalf("unable to unmarshal status event: %v", err)
+			}
+			statuses = append(statuses, event)
+			return
+		}
+		published = payload
+	}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+	setDriveMode := func(c *Controller, m events.DriveMode) {
+		c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: m}))
+	}
+
+	now := time.Now()
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithDriveModeTransitions(-0.2, -0.5, 300*time.Millisecond, time.Second),
+		WithStatusTopic("topic/status"),
+	)
+	c.transitions.clock = func() time.Time { return now }
+
+	setDriveMode(c, events.DriveMode_PILOT)
+	now = now.Add(500 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); math.Abs(float64(got-0.4)) > 0.0001 {
+		t.Errorf("soft start throttle should be published on pilot start: %v, want %v", got, 0.4)
+	}
+	now = now.Add(time.Second)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.8 {
+		t.Errorf("processor throttle should be published after soft start: %v, want %v", got, 0.8)
+	}
+
+	published = nil
+	setDriveMode(c, events.DriveMode_USER)
+	if got := readThrottle(); got != -0.2 {
+		t.Errorf("exit throttle should be published when leaving pilot mode: %v, want %v", got, -0.2)
+	}
+	now = now.Add(100 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.2 {
+		t.Errorf("exit throttle should be held: %v, want %v", got, -0.2)
+	}
+	published = nil
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.}))
+	if published != nil {
+		t.Errorf("neutral rc throttle shouldn't interrupt exit throttle")
+	}
+	now = now.Add(300 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0. {
+		t.Errorf("neutral should be published at end of hold: %v, want %v", got, 0.)
+	}
+	published = nil
+	c.onPublishPilotValue()
+	if published != nil {
+		t.Errorf("nothing should be published on user mode after hold")
+	}
+
+	published = nil
+	setDriveMode(c, events.DriveMode_USER)
+	if published != nil {
+		t.Errorf("nothing should be published when drive mode doesn't change")
+	}
+
+	setDriveMode(c, events.DriveMode_INVALID)
+	if got := readThrottle(); got != -0.5 {
+		t.Errorf("stop throttle should be published on invalid drive mode: %v, want %v", got, -0.5)
+	}
+	now = now.Add(100 * time.Millisecond)
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -0.5 {
+		t.Errorf("stop throttle should be held on invalid drive mode: %v, want %v", got, -0.5)
+	}
+	now = now.Add(300 * time.Millisecond)
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0. {
+		t.Errorf("neutral should be published at end of stop: %v, want %v", got, 0.)
+	}
+	published = nil
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+	c.onPublishPilotValue()
+	if published != nil {
+		t.Errorf("nothing should be published on invalid drive mode")
+	}
+
+	wantStates := []string{"PILOT", "USER", "INVALID"}
+	if len(statuses) != len(wantStates) {
+		t.Fatalf("bad status events number: %v, want %v", statuses, wantStates)
+	}
+	for i, s := range statuses {
+		if s.Component != "drive_mode" || s.State != wantStates[i] {
+			t.Errorf("bad status event %d: %v, want drive_mode %v", i, s, wantStates[i])
+		}
+	}
+}
+
+func TestController_DriveModeTransitionsUserTakesControl(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithDriveModeTransitions(-0.2, -0.5, time.Hour, 0),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_USER}))
+	if got := readThrottle(); got != -0.2 {
+		t.Errorf("exit throttle should be published when leaving pilot mode: %v, want %v", got, -0.2)
+	}
+
+	c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.3}))
+	if got := readThrottle(); got != 0.3 {
+		t.Errorf("rc throttle should be published: %v, want %v", got, 0.3)
+	}
+	published = nil
+	c.onPublishPilotValue()
+	if published != nil {
+		t.Errorf("exit throttle shouldn't be published once user takes control")
+	}
+}
+
+func TestController_EStop(t *testing.T) {
+	oldPublish := publish
+	oldPublishRetained := publishRetained
+	defer func() {
+		publish = oldPublish
+		publishRetained = oldPublishRetained
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	var retained []byte
+	publishRetained = func(client mqtt.Client, topic string, payload []byte) {
+		if topic != "topic/estop" {
+			t.Errorf("bad retained topic: %v", topic)
+		}
+		retained = payload
+	}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	for _, driveMode := range []events.DriveMode{events.DriveMode_USER, events.DriveMode_COPILOT, events.DriveMode_PILOT} {
+		t.Run(driveMode.String(), func(t *testing.T) {
+			now := time.Now()
+			c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+				"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+				WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+				WithEStop("topic/estop", -0.6, 500*time.Millisecond, "secret"),
+			)
+			c.eStop.clock = func() time.Time { return now }
+			c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: driveMode}))
+
+			published = nil
+			retained = nil
+			c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop", "reason": "pit"}`)))
+			if got := readThrottle(); got != -0.6 {
+				t.Errorf("brake should be published on e-stop: %v, want %v", got, -0.6)
+			}
+			var state EStopMessage
+			if err := json.Unmarshal(retained, &state); err != nil || state.Action != EStopActionStop {
+				t.Errorf("stop state should be retained: %s", retained)
+			}
+
+			published = nil
+			c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+			if published != nil {
+				t.Errorf("rc throttle should be suppressed on e-stop")
+			}
+
+			now = now.Add(time.Second)
+			c.onPublishPilotValue()
+			if got := readThrottle(); got != 0. {
+				t.Errorf("neutral should be published after e-stop brake: %v, want %v", got, 0.)
+			}
+
+			c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "reset", "token": "bad"}`)))
+			c.onPublishPilotValue()
+			if got := readThrottle(); got != 0. {
+				t.Errorf("e-stop should stay latched with bad token: %v, want %v", got, 0.)
+			}
+
+			c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "reset", "token": "secret"}`)))
+			if len(retained) != 0 {
+				t.Errorf("retained state should be cleared on reset: %s", retained)
+			}
+			published = nil
+			c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+			c.onPublishPilotValue()
+			if driveMode != events.DriveMode_PILOT && published == nil {
+				t.Errorf("rc throttle should be published after reset")
+			}
+			if driveMode == events.DriveMode_PILOT && readThrottle() != 0.8 {
+				t.Errorf("autopilot throttle should be published after reset: %v, want %v", readThrottle(), 0.8)
+			}
+		})
+	}
+}
+
+func TestController_EStopRetained(t *testing.T) {
+	oldPublish := publish
+	oldPublishRetained := publishRetained
+	defer func() {
+		publish = oldPublish
+		publishRetained = oldPublishRetained
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	retainedCount := 0
+	publishRetained = func(client mqtt.Client, topic string, payload []byte) {
+		retainedCount++
+	}
+
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithEStop("topic/estop", -0.6, time.Second, "secret"),
+	)
+	// Empty retained payload after reset is ignored
+	c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte{}))
+	if c.eStop.latched {
+		t.Errorf("e-stop shouldn't be latched by empty message")
+	}
+
+	// Retained state restored on restart, car is already stopped
+	c.onEStop(nil, retainedMessage{testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop"}`))})
+	var first events.ThrottleMessage
+	if err := proto.Unmarshal(published, &first); err != nil || first.GetThrottle() != 0. {
+		t.Errorf("brake shouldn't be published on restored e-stop: %v", first.GetThrottle())
+	}
+	if retainedCount != 0 {
+		t.Errorf("restored state shouldn't be published again")
+	}
+	c.onPublishPilotValue()
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(published, &msg); err != nil || msg.GetThrottle() != 0. {
+		t.Errorf("neutral should be published on restored e-stop: %v", msg.GetThrottle())
+	}
+}
+
+func TestController_OutputController(t *testing.T) {
+	oldPublish := publish
+	oldPublishRetained := publishRetained
+	defer func() {
+		publish = oldPublish
+		publishRetained = oldPublishRetained
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	publishRetained = func(client mqtt.Client, topic string, payload []byte) {}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithOutputController(brake.NewESCController(&brake.DisabledController{}, brake.ESCForwardBrakeReverse, 0)),
+		WithEStop("topic/estop", -0.6, time.Second, "secret"),
+	)
+
+	// RC throttle is published unchanged on USER mode, even if ESC reverses
+	for _, v := range []float32{0.5, -0.5, 0.} {
+		c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: v}))
+		if got := readThrottle(); got != v {
+			t.Errorf("rc throttle should be published unchanged: %v, want %v", got, v)
+		}
+	}
+
+	// E-stop brake is published as configured
+	c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop"}`)))
+	if got := readThrottle(); got != -0.6 {
+		t.Errorf("e-stop brake shouldn't be adjusted by output controller: %v, want %v", got, -0.6)
+	}
+}
+
+func TestController_EStopSlewOutput(t *testing.T) {
+	oldPublish := publish
+	oldPublishRetained := publishRetained
+	defer func() {
+		publish = oldPublish
+		publishRetained = oldPublishRetained
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+	publishRetained = func(client mqtt.Client, topic string, payload []byte) {}
+	readThrottle := func() float32 {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(published, &msg); err != nil {
+			t.Fatalf("unable to unmarshall response: %v", err)
+		}
+		return msg.GetThrottle()
+	}
+
+	slew := brake.NewSlewController(&brake.DisabledController{}, &brake.SlewConfig{AccelerationRate: 1., DecelerationRate: 1.})
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(NewSteeringProcessor(0.1, 0.8)),
+		WithOutputController(brake.NewESCController(slew, brake.ESCForwardBrake, 0)),
+		WithEStop("topic/estop", -1., 500*time.Millisecond, "secret"),
+	)
+	c.onThrottleFeedback(nil, testtools.NewFakeMessageFromProtobuf("topic/feedback/throttle", &events.ThrottleMessage{Throttle: 0.3}))
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != 0.3 {
+		t.Errorf("slew limiter should start from real throttle: %v, want %v", got, 0.3)
+	}
+
+	c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop"}`)))
+	if got := readThrottle(); got != -1. {
+		t.Errorf("e-stop brake shouldn't be rate limited: %v, want %v", got, -1.)
+	}
+	c.onPublishPilotValue()
+	if got := readThrottle(); got != -1. {
+		t.Errorf("e-stop brake shouldn't be rate limited: %v, want %v", got, -1.)
+	}
+
+	// Slew limiter would restart from real throttle on first value
+	slew = brake.NewSlewController(&brake.DisabledController{}, &brake.SlewConfig{AccelerationRate: 1., DecelerationRate: 1.})
+	c = New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithOutputController(brake.NewESCController(slew, brake.ESCForwardBrake, 0)),
+		WithEStop("topic/estop", -1., 500*time.Millisecond, "secret"),
+	)
+	c.onThrottleFeedback(nil, testtools.NewFakeMessageFromProtobuf("topic/feedback/throttle", &events.ThrottleMessage{Throttle: 0.4}))
+	c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop"}`)))
+	if got := readThrottle(); got != -1. {
+		t.Errorf("e-stop brake should be published as configured: %v, want %v", got, -1.)
+	}
+}
+
+func TestController_SteeringWatchdogOutput(t *testing.T) {
+	oldPublish := publish
+	defer func() {
+		publish = oldPublish
+	}()
+	var published []byte
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		published = payload
+	}
+
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithSteeringWatchdog(200*time.Millisecond, SteeringTimestampReceipt, &Failsafe{Mode: FailsafeBrake, Throttle: -0.2}),
+		WithOutputController(brake.NewESCController(&brake.DisabledController{}, brake.ESCCrawler, 0)),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_PILOT}))
+	c.onPublishPilotValue()
+
+	var msg events.ThrottleMessage
+	if err := proto.Unmarshal(published, &msg); err != nil {
+		t.Fatalf("unable to unmarshall response: %v", err)
+	}
+	if msg.GetThrottle() != 0. {
+		t.Errorf("failsafe brake should be adjusted by crawler esc profile: %v, want %v", msg.GetThrottle(), 0.)
+	}
+}
+
+type retainedMessage struct {
+	mqtt.Message
+}
+
+func (r retainedMessage) Retained() bool {
+	return true
+}
+
+func TestController_EStopOrdering(t *testing.T) {
+	oldPublish := publish
+	oldPublishRetained := publishRetained
+	defer func() {
+		publish = oldPublish
+		publishRetained = oldPublishRetained
+	}()
+	var mu sync.Mutex
+	var published []float32
+	publish = func(client mqtt.Client, topic string, payload []byte) {
+		var msg events.ThrottleMessage
+		if err := proto.Unmarshal(payload, &msg); err != nil {
+			t.Errorf("unable to unmarshall response: %v", err)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, msg.GetThrottle())
+	}
+	publishRetained = func(client mqtt.Client, topic string, payload []byte) {}
+
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithEStop("topic/estop", -0.6, time.Second, "secret"),
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			c.onRCThrottle(nil, testtools.NewFakeMessageFromProtobuf("topic/rcThrottle", &events.ThrottleMessage{Throttle: 0.5}))
+		}
+	}()
+	time.Sleep(time.Millisecond)
+	c.onEStop(nil, testtools.NewFakeMessage("topic/estop", []byte(`{"action": "stop"}`)))
+	wg.Wait()
+
+	brake := false
+	for i, v := range published {
+		if v == -0.6 {
+			brake = true
+		} else if brake {
+			t.Fatalf("rc throttle published after e-stop brake at %d: %v", i, v)
+		}
+	}
+	if !brake {
+		t.Errorf("e-stop brake should be published")
+	}
+}
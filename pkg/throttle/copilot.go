@@ -0,0 +1,99 @@
+package throttle
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+)
+
+type CopilotStrategy string
+
+const (
+	// CopilotRC republishes user throttle
+	CopilotRC CopilotStrategy = "rc"
+	// CopilotCap uses processor throttle, capped by user throttle
+	CopilotCap CopilotStrategy = "cap"
+	// CopilotBlend uses weighted average of processor and user throttle
+	CopilotBlend CopilotStrategy = "blend"
+	// CopilotBrake uses user throttle, brake controller slows car down when processor throttle is exceeded
+	CopilotBrake CopilotStrategy = "brake"
+)
+
+func NewCopilotStrategy(value string) (CopilotStrategy, error) {
+	switch s := CopilotStrategy(value); s {
+	case CopilotRC, CopilotCap, CopilotBlend, CopilotBrake:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid copilot strategy '%v', accepted values: %v, %v, %v, %v", value,
+		CopilotRC, CopilotCap, CopilotBlend, CopilotBrake)
+}
+
+// WithCopilotStrategy selects how user and processor throttle are combined on COPILOT mode
+func WithCopilotStrategy(s CopilotStrategy) Option {
+	return func(c *Controller) {
+		c.copilotStrategy = s
+	}
+}
+
+// WithCopilotBlendWeight sets weight of processor throttle with blend strategy, user throttle weight is 1 - weight
+func WithCopilotBlendWeight(weight float64) Option {
+	return func(c *Controller) {
+		c.copilotBlendWeight = weight
+	}
+}
+
+// updateCopilotTarget computes, on publish tick, processor throttle limited by limiters. Processor is stateful and
+// must only be called at tick rate, RC callback reuses this value.
+func (c *Controller) updateCopilotTarget() {
+	if c.copilotStrategy == CopilotRC {
+		return
+	}
+	target := c.processor.Process(c.readSteering())
+	for _, l := range c.limiters {
+		target = l.Limit(target)
+	}
+
+	c.muCopilot.Lock()
+	defer c.muCopilot.Unlock()
+	c.copilotTarget = target
+	c.copilotReady = true
+}
+
+// resetCopilotTarget discards last processor throttle, called on drive mode change
+func (c *Controller) resetCopilotTarget() {
+	c.muCopilot.Lock()
+	defer c.muCopilot.Unlock()
+	c.copilotReady = false
+}
+
+func (c *Controller) readCopilotTarget() (types.Throttle, bool) {
+	c.muCopilot.RLock()
+	defer c.muCopilot.RUnlock()
+	return c.copilotTarget, c.copilotReady
+}
+
+// copilotThrottle combines user throttle with last processor throttle computed on publish tick regarding copilot
+// strategy. Brake and reverse from user are always applied. User throttle is returned until first tick on COPILOT mode.
+func (c *Controller) copilotThrottle(user types.Throttle) types.Throttle {
+	if c.copilotStrategy == CopilotRC || user <= 0. {
+		return user
+	}
+
+	processorThrottle, ok := c.readCopilotTarget()
+	if !ok {
+		return user
+	}
+	switch c.copilotStrategy {
+	case CopilotCap:
+		if processorThrottle < user {
+			return processorThrottle
+		}
+	case CopilotBlend:
+		return types.Throttle(c.copilotBlendWeight)*processorThrottle +
+			types.Throttle(1-c.copilotBlendWeight)*user
+	case CopilotBrake:
+		if user > processorThrottle {
+			return c.brakeCtrl.AdjustThrottle(processorThrottle)
+		}
+	}
+	return user
+}
@@ -0,0 +1,29 @@
+package throttle
+
+import "testing"
+
+func TestNewCopilotStrategy(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    CopilotStrategy
+		wantErr bool
+	}{
+		{value: "rc", want: CopilotRC},
+		{value: "cap", want: CopilotCap},
+		{value: "blend", want: CopilotBlend},
+		{value: "brake", want: CopilotBrake},
+		{value: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := NewCopilotStrategy(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewCopilotStrategy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("NewCopilotStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
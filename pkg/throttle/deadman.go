@@ -0,0 +1,65 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// WithDeadMan publishes PILOT throttle only while rc throttle is held above threshold. Release throttle, neutral or
+// brake, is published as soon as rc throttle is released or no rc message is received since timeout.
+func WithDeadMan(threshold types.Throttle, timeout time.Duration, release types.Throttle) Option {
+	return func(c *Controller) {
+		c.deadMan = &deadMan{
+			threshold: threshold,
+			timeout:   timeout,
+			release:   release,
+			clock:     time.Now,
+		}
+	}
+}
+
+type deadMan struct {
+	threshold types.Throttle
+	timeout   time.Duration
+	release   types.Throttle
+	clock     func() time.Time
+
+	mu          sync.Mutex
+	trigger     types.Throttle
+	lastMessage time.Time
+	held        bool
+}
+
+// SetTrigger returns true if trigger is released by this value
+func (d *deadMan) SetTrigger(t types.Throttle) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	released := d.trigger >= d.threshold && t < d.threshold
+	d.trigger = t
+	d.lastMessage = d.clock()
+	return released
+}
+
+// Held returns true if trigger is held and fresh
+func (d *deadMan) Held() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	held := d.trigger >= d.threshold
+	if held && d.clock().Sub(d.lastMessage) > d.timeout {
+		if d.held {
+			zap.S().Warnf("dead-man: no rc throttle since %v, release autopilot throttle", d.timeout)
+		}
+		held = false
+	} else if held != d.held {
+		if held {
+			zap.S().Infof("dead-man: trigger held, enable autopilot throttle")
+		} else {
+			zap.S().Infof("dead-man: trigger released, release autopilot throttle")
+		}
+	}
+	d.held = held
+	return held
+}
@@ -0,0 +1,62 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestDeadMan_Held(t *testing.T) {
+	tests := []struct {
+		name     string
+		noSignal bool
+		trigger  types.Throttle
+		elapsed  time.Duration
+		want     bool
+	}{
+		{name: "no rc message", noSignal: true, want: false},
+		{name: "trigger held", trigger: 0.5, elapsed: 100 * time.Millisecond, want: true},
+		{name: "trigger on threshold", trigger: 0.2, want: true},
+		{name: "trigger released", trigger: 0.1, want: false},
+		{name: "trigger on brake", trigger: -0.5, want: false},
+		{name: "rc timeout", trigger: 0.5, elapsed: 600 * time.Millisecond, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+				"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+				WithDeadMan(0.2, 500*time.Millisecond, -0.1),
+			)
+			d := c.deadMan
+			d.clock = func() time.Time { return now }
+
+			if !tt.noSignal {
+				d.SetTrigger(tt.trigger)
+			}
+			now = now.Add(tt.elapsed)
+			if got := d.Held(); got != tt.want {
+				t.Errorf("Held() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadMan_SetTrigger(t *testing.T) {
+	d := deadMan{threshold: 0.2, timeout: 500 * time.Millisecond, clock: time.Now}
+	steps := []struct {
+		trigger      types.Throttle
+		wantReleased bool
+	}{
+		{trigger: 0., wantReleased: false},
+		{trigger: 0.5, wantReleased: false},
+		{trigger: 0.3, wantReleased: false},
+		{trigger: 0.1, wantReleased: true},
+		{trigger: 0., wantReleased: false},
+	}
+	for i, s := range steps {
+		if got := d.SetTrigger(s.trigger); got != s.wantReleased {
+			t.Errorf("step %d: SetTrigger() = %v, want %v", i, got, s.wantReleased)
+		}
+	}
+}
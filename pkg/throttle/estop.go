@@ -0,0 +1,151 @@
+package throttle
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type EStopAction string
+
+const (
+	// EStopActionStop latches emergency stop
+	EStopActionStop EStopAction = "stop"
+	// EStopActionReset releases emergency stop if token matches
+	EStopActionReset EStopAction = "reset"
+)
+
+// EStopMessage is the json payload of emergency stop topic
+type EStopMessage struct {
+	Action EStopAction `json:"action"`
+	// Token must match configured reset token to release emergency stop
+	Token  string `json:"token,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// WithEStop subscribes to emergency stop topic. Once a stop message is received, brake throttle is published during
+// brakeDuration, then neutral, whatever drive mode is. RC throttle is ignored until a reset message with resetToken
+// is received. Latched state is retained on topic, so a restarted service comes back stopped. Brake and neutral are
+// published as configured, output controller only observes them.
+func WithEStop(topic string, brake types.Throttle, brakeDuration time.Duration, resetToken string) Option {
+	return func(c *Controller) {
+		c.eStopTopic = topic
+		c.eStop = &eStop{
+			brake:         brake,
+			brakeDuration: brakeDuration,
+			resetToken:    resetToken,
+			clock:         time.Now,
+		}
+	}
+}
+
+type eStop struct {
+	brake         types.Throttle
+	brakeDuration time.Duration
+	resetToken    string
+	clock         func() time.Time
+
+	// mu is read locked while a throttle is published, so that emergency stop can't be latched between state check
+	// and publication
+	mu        sync.RWMutex
+	latched   bool
+	latchedAt time.Time
+}
+
+// latch returns false if emergency stop was already latched, mu write lock must be held. Restored latch skips brake,
+// car is already stopped.
+func (e *eStop) latch(restored bool) bool {
+	if e.latched {
+		return false
+	}
+	e.latched = true
+	e.latchedAt = e.clock()
+	if restored {
+		e.latchedAt = e.latchedAt.Add(-e.brakeDuration)
+	}
+	return true
+}
+
+// reset releases emergency stop if token matches, it returns false if emergency stop isn't released. mu write lock
+// must be held.
+func (e *eStop) reset(token string) bool {
+	if !e.latched {
+		return false
+	}
+	if e.resetToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(e.resetToken)) != 1 {
+		zap.S().Warnf("e-stop: bad reset token, keep emergency stop")
+		return false
+	}
+	e.latched = false
+	return true
+}
+
+// throttle returns throttle to publish and true if emergency stop is latched, mu lock must be held
+func (e *eStop) throttle() (types.Throttle, bool) {
+	if !e.latched {
+		return 0., false
+	}
+	if e.clock().Sub(e.latchedAt) < e.brakeDuration {
+		return e.brake, true
+	}
+	return 0., true
+}
+
+func (c *Controller) onEStop(_ mqtt.Client, message mqtt.Message) {
+	if len(message.Payload()) == 0 {
+		// Retained state cleared on reset
+		return
+	}
+	var msg EStopMessage
+	if err := json.Unmarshal(message.Payload(), &msg); err != nil {
+		zap.S().Errorf("unable to unmarshal e-stop message: %v", err)
+		return
+	}
+
+	c.eStop.mu.Lock()
+	defer c.eStop.mu.Unlock()
+
+	switch msg.Action {
+	case EStopActionStop:
+		// Retained message is our own state, received on restart
+		restored := message.Retained()
+		if !c.eStop.latch(restored) {
+			return
+		}
+		zap.S().Warnf("e-stop: emergency stop latched (restored: %v), reason: %v", restored, msg.Reason)
+		throttle, _ := c.eStop.throttle()
+		c.publishObservedThrottle(throttle, 1.)
+		if !restored {
+			payload, err := json.Marshal(&EStopMessage{Action: EStopActionStop, Reason: msg.Reason})
+			if err != nil {
+				zap.S().Errorf("unable to marshal e-stop state: %v", err)
+			} else {
+				publishRetained(c.client, c.eStopTopic, payload)
+			}
+		}
+		c.publishStatus("estop", "latched", msg.Reason)
+	case EStopActionReset:
+		if !c.eStop.reset(msg.Token) {
+			return
+		}
+		zap.S().Infof("e-stop: emergency stop released")
+		publishRetained(c.client, c.eStopTopic, []byte{})
+		c.publishStatus("estop", "released", msg.Reason)
+	default:
+		zap.S().Errorf("invalid e-stop action '%v', accepted values: %v, %v", msg.Action, EStopActionStop,
+			EStopActionReset)
+	}
+}
+
+// rLockEStop prevents emergency stop changes until unlock is called, latched is true if emergency stop is latched
+func (c *Controller) rLockEStop() (latched bool, unlock func()) {
+	if c.eStop == nil {
+		return false, func() {}
+	}
+	c.eStop.mu.RLock()
+	return c.eStop.latched, c.eStop.mu.RUnlock
+}
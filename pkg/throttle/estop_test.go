@@ -0,0 +1,72 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestEStop(t *testing.T) {
+	now := time.Now()
+	e := eStop{brake: -0.5, brakeDuration: 500 * time.Millisecond, resetToken: "secret",
+		clock: func() time.Time { return now }}
+
+	checkThrottle := func(want types.Throttle, wantLatched bool) {
+		t.Helper()
+		got, latched := e.throttle()
+		if latched != wantLatched {
+			t.Errorf("throttle() latched = %v, want %v", latched, wantLatched)
+		}
+		if got != want {
+			t.Errorf("throttle() = %v, want %v", got, want)
+		}
+	}
+
+	checkThrottle(0., false)
+	if e.reset("secret") {
+		t.Errorf("reset() should fail when e-stop isn't latched")
+	}
+
+	if !e.latch(false) {
+		t.Errorf("latch() should latch e-stop")
+	}
+	checkThrottle(-0.5, true)
+
+	now = now.Add(300 * time.Millisecond)
+	if e.latch(false) {
+		t.Errorf("latch() should fail when e-stop is already latched")
+	}
+	checkThrottle(-0.5, true)
+
+	now = now.Add(300 * time.Millisecond)
+	checkThrottle(0., true)
+
+	if e.reset("bad") {
+		t.Errorf("reset() should fail with bad token")
+	}
+	if e.reset("") {
+		t.Errorf("reset() should fail without token")
+	}
+	checkThrottle(0., true)
+
+	if !e.reset("secret") {
+		t.Errorf("reset() should release e-stop with matching token")
+	}
+	checkThrottle(0., false)
+}
+
+func TestEStop_Restored(t *testing.T) {
+	e := eStop{brake: -0.5, brakeDuration: 500 * time.Millisecond, resetToken: "secret", clock: time.Now}
+	e.latch(true)
+	if got, latched := e.throttle(); !latched || got != 0. {
+		t.Errorf("restored e-stop should publish neutral: %v (latched: %v)", got, latched)
+	}
+}
+
+func TestEStop_ResetWithoutToken(t *testing.T) {
+	e := eStop{clock: time.Now}
+	e.latch(false)
+	if e.reset("") {
+		t.Errorf("reset() should fail when no reset token is configured")
+	}
+}
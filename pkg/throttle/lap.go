@@ -0,0 +1,445 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// LapProcessor is implemented by processors that need to know when car crosses the lap line
+type LapProcessor interface {
+	NewLap()
+}
+
+type LapDetection string
+
+const (
+	// LapDetectionTopic uses lap line events
+	LapDetectionTopic LapDetection = "topic"
+	// LapDetectionSteering looks for periodicity in steering history
+	LapDetectionSteering LapDetection = "steering"
+)
+
+const (
+	// lapPauseTimeout invalidates current lap when processor isn't called, car is probably not driven by autopilot
+	lapPauseTimeout = 2 * time.Second
+	// lapSampleBin is the resolution used to search steering periodicity
+	lapSampleBin = 50 * time.Millisecond
+	// lapDetectionInterval is the minimum interval between two searches of steering periodicity
+	lapDetectionInterval = 1 * time.Second
+)
+
+func NewLapConfigFromJson(fileName string) (*LapConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg LapConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	switch cfg.Detection {
+	case LapDetectionTopic, LapDetectionSteering:
+	default:
+		return nil, fmt.Errorf("invalid detection '%v', accepted values: %v, %v", cfg.Detection,
+			LapDetectionTopic, LapDetectionSteering)
+	}
+	if cfg.Segments <= 0 {
+		return nil, fmt.Errorf("invalid segments number, value must be > 0: %v", cfg.Segments)
+	}
+	if cfg.Step <= 0. {
+		return nil, fmt.Errorf("invalid step, value must be > 0: %v", cfg.Step)
+	}
+	if cfg.MinOffset > 0. || cfg.MaxOffset < 0. {
+		return nil, fmt.Errorf("invalid offsets: %v <= 0.0 <= %v", cfg.MinOffset, cfg.MaxOffset)
+	}
+	if cfg.SaturationSteering <= 0. || cfg.SaturationSteering > 1. {
+		return nil, fmt.Errorf("invalid saturation steering: 0.0 < %v <= 1.0", cfg.SaturationSteering)
+	}
+	if cfg.MinLapMs <= 0 || cfg.MaxLapMs <= cfg.MinLapMs {
+		return nil, fmt.Errorf("invalid lap durations: 0 < %v < %v", cfg.MinLapMs, cfg.MaxLapMs)
+	}
+	if cfg.Detection == LapDetectionSteering && (cfg.MinCorrelation <= 0. || cfg.MinCorrelation > 1.) {
+		return nil, fmt.Errorf("invalid min correlation: 0.0 < %v <= 1.0", cfg.MinCorrelation)
+	}
+	return &cfg, nil
+}
+
+type LapConfig struct {
+	Detection LapDetection `json:"detection"`
+	// Segments is the number of parts the lap is split into
+	Segments int `json:"segments"`
+	// Step is the throttle offset change applied to a segment after each lap
+	Step types.Throttle `json:"step"`
+	// MinOffset and MaxOffset bound throttle offset of each segment
+	MinOffset types.Throttle `json:"min_offset"`
+	MaxOffset types.Throttle `json:"max_offset"`
+	// SaturationSteering is the absolute steering above which a segment isn't considered as cleanly completed
+	SaturationSteering types.Steering `json:"saturation_steering"`
+	// MinLapMs and MaxLapMs bound plausible lap durations
+	MinLapMs int `json:"min_lap_ms"`
+	MaxLapMs int `json:"max_lap_ms"`
+	// MinCorrelation is the steering autocorrelation needed to detect a lap with steering detection
+	MinCorrelation float64 `json:"min_correlation,omitempty"`
+	// ProfileFile is the path where throttle profile is saved, profile isn't saved if empty. Saved profile is ignored
+	// on load if it doesn't match segments, offsets or lap duration limits
+	ProfileFile string `json:"profile_file,omitempty"`
+}
+
+// LapProfile is the learnt throttle offset of each lap segment
+type LapProfile struct {
+	LapDurationMs int64            `json:"lap_duration_ms"`
+	Offsets       []types.Throttle `json:"offsets"`
+}
+
+// NewLapLearningProcessor build a processor that learns, lap after lap, a throttle offset to apply on each
+// segment of the track
+func NewLapLearningProcessor(base Processor, cfg *LapConfig) *LapLearningProcessor {
+	l := &LapLearningProcessor{
+		base:        base,
+		cfg:         cfg,
+		clock:       time.Now,
+		profile:     LapProfile{Offsets: make([]types.Throttle, cfg.Segments)},
+		maxSteering: make([]types.Steering, cfg.Segments),
+		visited:     make([]bool, cfg.Segments),
+	}
+	if cfg.ProfileFile != "" {
+		profile, err := loadLapProfile(cfg.ProfileFile, cfg)
+		if err != nil {
+			zap.S().Warnf("unable to load lap profile, start with empty profile: %v", err)
+		} else {
+			l.profile = *profile
+		}
+	}
+	return l
+}
+
+type LapLearningProcessor struct {
+	base  Processor
+	cfg   *LapConfig
+	clock func() time.Time
+
+	mu          sync.Mutex
+	profile     LapProfile
+	lapStart    time.Time
+	lastProcess time.Time
+	maxSteering []types.Steering
+	visited     []bool
+
+	// steering periodicity detection
+	samples       []steeringSample
+	period        time.Duration
+	lastDetection time.Time
+}
+
+func (l *LapLearningProcessor) SetSpeedZone(sz events.SpeedZone) {
+	l.base.SetSpeedZone(sz)
+}
+
+func (l *LapLearningProcessor) SetRealThrottle(t types.Throttle) {
+	if fp, ok := l.base.(FeedbackProcessor); ok {
+		fp.SetRealThrottle(t)
+	}
+}
+
+func (l *LapLearningProcessor) SetRoad(road *events.RoadMessage) {
+	if rp, ok := l.base.(RoadProcessor); ok {
+		rp.SetRoad(road)
+	}
+}
+
+func (l *LapLearningProcessor) SetObjects(objects *events.ObjectsMessage) {
+	if op, ok := l.base.(ObjectsProcessor); ok {
+		op.SetObjects(objects)
+	}
+}
+
+func (l *LapLearningProcessor) SetDriveMode(dm events.DriveMode) {
+	if dp, ok := l.base.(DriveModeProcessor); ok {
+		dp.SetDriveMode(dm)
+	}
+}
+
+func (l *LapLearningProcessor) RecordSteering(msg *events.SteeringMessage) {
+	if sr, ok := l.base.(SteeringRecorder); ok {
+		sr.RecordSteering(msg)
+	}
+}
+
+// NewLap notifies car crosses lap line
+func (l *LapLearningProcessor) NewLap() {
+	if l.cfg.Detection != LapDetectionTopic {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.completeLap(l.clock())
+}
+
+// Profile returns a copy of current throttle profile
+func (l *LapLearningProcessor) Profile() LapProfile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	offsets := make([]types.Throttle, len(l.profile.Offsets))
+	copy(offsets, l.profile.Offsets)
+	return LapProfile{LapDurationMs: l.profile.LapDurationMs, Offsets: offsets}
+}
+
+// Process compute base throttle and apply offset learnt for current lap segment
+func (l *LapLearningProcessor) Process(steering types.Steering) types.Throttle {
+	throttle := l.base.Process(steering)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock()
+	if !l.lastProcess.IsZero() && now.Sub(l.lastProcess) > lapPauseTimeout {
+		zap.S().Infof("lap learning paused, drop current lap")
+		l.resetLap()
+	}
+	l.lastProcess = now
+
+	if l.cfg.Detection == LapDetectionSteering {
+		l.detectLap(now, steering)
+	}
+
+	segment, ok := l.segment(now)
+	if !ok {
+		return throttle
+	}
+	st := types.Steering(math.Abs(float64(steering)))
+	if st > l.maxSteering[segment] {
+		l.maxSteering[segment] = st
+	}
+	l.visited[segment] = true
+
+	throttle += l.profile.Offsets[segment]
+	if throttle < 0. {
+		return 0.
+	}
+	if throttle > 1. {
+		return 1.
+	}
+	return throttle
+}
+
+// segment returns segment index of current lap, false if lap progress is unknown
+func (l *LapLearningProcessor) segment(now time.Time) (int, bool) {
+	if l.lapStart.IsZero() || l.profile.LapDurationMs <= 0 {
+		return 0, false
+	}
+	progress := float64(now.Sub(l.lapStart).Milliseconds()) / float64(l.profile.LapDurationMs)
+	segment := int(progress * float64(l.cfg.Segments))
+	if segment >= l.cfg.Segments {
+		segment = l.cfg.Segments - 1
+	}
+	return segment, true
+}
+
+func (l *LapLearningProcessor) resetLap() {
+	l.lapStart = time.Time{}
+	l.samples = nil
+	l.period = 0
+	for i := range l.maxSteering {
+		l.maxSteering[i] = 0.
+		l.visited[i] = false
+	}
+}
+
+// completeLap updates profile with lap just finished and starts a new one
+func (l *LapLearningProcessor) completeLap(now time.Time) {
+	if l.lapStart.IsZero() {
+		zap.S().Infof("lap learning: first lap line crossed")
+		l.startLap(now)
+		return
+	}
+
+	duration := now.Sub(l.lapStart)
+	if duration < time.Duration(l.cfg.MinLapMs)*time.Millisecond || duration > time.Duration(l.cfg.MaxLapMs)*time.Millisecond {
+		zap.S().Infof("lap learning: ignore lap with unexpected duration %v", duration)
+		l.startLap(now)
+		return
+	}
+
+	if l.profile.LapDurationMs > 0 {
+		for i := range l.profile.Offsets {
+			if !l.visited[i] {
+				continue
+			}
+			if l.maxSteering[i] >= l.cfg.SaturationSteering {
+				l.profile.Offsets[i] = types.Throttle(math.Max(float64(l.cfg.MinOffset), float64(l.profile.Offsets[i]-l.cfg.Step)))
+			} else {
+				l.profile.Offsets[i] = types.Throttle(math.Min(float64(l.cfg.MaxOffset), float64(l.profile.Offsets[i]+l.cfg.Step)))
+			}
+		}
+	}
+	l.profile.LapDurationMs = duration.Milliseconds()
+	zap.S().Infof("lap learning: lap completed in %v, new profile: %v", duration, l.profile.Offsets)
+
+	if l.cfg.ProfileFile != "" {
+		if err := saveLapProfile(l.cfg.ProfileFile, &l.profile); err != nil {
+			zap.S().Errorf("unable to save lap profile: %v", err)
+		}
+	}
+	l.startLap(now)
+}
+
+func (l *LapLearningProcessor) startLap(now time.Time) {
+	l.lapStart = now
+	for i := range l.maxSteering {
+		l.maxSteering[i] = 0.
+		l.visited[i] = false
+	}
+}
+
+// detectLap records steering and completes lap when steering periodicity is found
+func (l *LapLearningProcessor) detectLap(now time.Time, steering types.Steering) {
+	l.samples = append(l.samples, steeringSample{at: now, steering: float64(steering)})
+	limit := now.Add(-2 * time.Duration(l.cfg.MaxLapMs) * time.Millisecond)
+	idx := 0
+	for idx < len(l.samples) && l.samples[idx].at.Before(limit) {
+		idx++
+	}
+	l.samples = l.samples[idx:]
+
+	if l.period > 0 && !l.lapStart.IsZero() && now.Sub(l.lapStart) >= l.period {
+		l.completeLap(now)
+		l.lastDetection = time.Time{}
+	}
+
+	if l.period > 0 && !l.lastDetection.IsZero() {
+		return
+	}
+	if !l.lastDetection.IsZero() && now.Sub(l.lastDetection) < lapDetectionInterval {
+		return
+	}
+	l.lastDetection = now
+
+	period, found := steeringPeriod(l.samples, lapSampleBin,
+		time.Duration(l.cfg.MinLapMs)*time.Millisecond, time.Duration(l.cfg.MaxLapMs)*time.Millisecond,
+		l.cfg.MinCorrelation)
+	if !found {
+		return
+	}
+	if l.period == 0 {
+		zap.S().Infof("lap learning: steering period detected: %v", period)
+		l.completeLap(now)
+	}
+	l.period = period
+}
+
+// steeringPeriod searches the lag that maximizes steering autocorrelation
+func steeringPeriod(samples []steeringSample, bin, minLag, maxLag time.Duration, minCorrelation float64) (time.Duration, bool) {
+	if len(samples) < 2 {
+		return 0, false
+	}
+	start := samples[0].at
+	n := int(samples[len(samples)-1].at.Sub(start)/bin) + 1
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for _, s := range samples {
+		i := int(s.at.Sub(start) / bin)
+		sums[i] += s.steering
+		counts[i]++
+	}
+	// Fill empty bins with previous value and center signal
+	values := make([]float64, n)
+	mean := 0.
+	for i := range values {
+		if counts[i] > 0 {
+			values[i] = sums[i] / float64(counts[i])
+		} else if i > 0 {
+			values[i] = values[i-1]
+		}
+		mean += values[i]
+	}
+	mean /= float64(n)
+	for i := range values {
+		values[i] -= mean
+	}
+
+	minBin, maxBin := int(minLag/bin), int(maxLag/bin)
+	if maxBin > n/2 {
+		maxBin = n / 2
+	}
+	if minBin > maxBin {
+		return 0, false
+	}
+	correlations := make([]float64, maxBin+2)
+	for lag := minBin; lag <= maxBin+1 && lag < n; lag++ {
+		var xy, xx, yy float64
+		for i := 0; i+lag < n; i++ {
+			xy += values[i] * values[i+lag]
+			xx += values[i] * values[i]
+			yy += values[i+lag] * values[i+lag]
+		}
+		if xx == 0. || yy == 0. {
+			continue
+		}
+		correlations[lag] = xy / math.Sqrt(xx*yy)
+	}
+
+	// Multiples of period are also correlated, keep the first peak
+	bestLag := 0
+	for lag := minBin; lag <= maxBin; lag++ {
+		c := correlations[lag]
+		if c < minCorrelation || (lag > minBin && c < correlations[lag-1]) || c < correlations[lag+1] {
+			continue
+		}
+		bestLag = lag
+		break
+	}
+	if bestLag == 0 {
+		return 0, false
+	}
+	return time.Duration(bestLag) * bin, true
+}
+
+// loadLapProfile reads profile saved by a previous run, profile must be consistent with current config
+func loadLapProfile(fileName string, cfg *LapConfig) (*LapProfile, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var profile LapProfile
+	err = json.Unmarshal(content, &profile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if len(profile.Offsets) != cfg.Segments {
+		return nil, fmt.Errorf("invalid profile, %v segments expected: %v", cfg.Segments, len(profile.Offsets))
+	}
+	if profile.LapDurationMs < int64(cfg.MinLapMs) || profile.LapDurationMs > int64(cfg.MaxLapMs) {
+		return nil, fmt.Errorf("invalid profile, lap duration must be between %vms and %vms: %vms", cfg.MinLapMs,
+			cfg.MaxLapMs, profile.LapDurationMs)
+	}
+	for idx, o := range profile.Offsets {
+		if !(o >= cfg.MinOffset && o <= cfg.MaxOffset) {
+			return nil, fmt.Errorf("invalid profile, offset of segment %d must be between %v and %v: %v", idx,
+				cfg.MinOffset, cfg.MaxOffset, o)
+		}
+	}
+	return &profile, nil
+}
+
+func saveLapProfile(fileName string, profile *LapProfile) error {
+	content, err := json.Marshal(profile)
+	if err != nil {
+		return fmt.Errorf("unable to marshal lap profile: %w", err)
+	}
+	tmp := fileName + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return fmt.Errorf("unable to write lap profile to %s file: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, fileName); err != nil {
+		return fmt.Errorf("unable to write lap profile to %s file: %w", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testLapConfig(detection LapDetection, profileFile string) *LapConfig {
+	return &LapConfig{
+		Detection:          detection,
+		Segments:           4,
+		Step:               0.1,
+		MinOffset:          -0.2,
+		MaxOffset:          0.15,
+		SaturationSteering: 0.9,
+		MinLapMs:           1000,
+		MaxLapMs:           10000,
+		MinCorrelation:     0.8,
+		ProfileFile:        profileFile,
+	}
+}
+
+// driveLap calls processor during duration, steering is saturated on the 3rd quarter of lap
+func driveLap(l *LapLearningProcessor, now *time.Time, duration time.Duration) []types.Throttle {
+	period := 100 * time.Millisecond
+	result := make([]types.Throttle, 0)
+	for elapsed := time.Duration(0); elapsed < duration; elapsed += period {
+		steering := types.Steering(0.)
+		if elapsed >= duration/2 && elapsed < 3*duration/4 {
+			steering = 1.
+		}
+		result = append(result, l.Process(steering))
+		*now = now.Add(period)
+	}
+	return result
+}
+
+func TestLapLearningProcessor_LapTopic(t *testing.T) {
+	profileFile := path.Join(t.TempDir(), "profile.json")
+	now := time.Now()
+	l := NewLapLearningProcessor(NewSteeringProcessor(0.2, 0.5), testLapConfig(LapDetectionTopic, profileFile))
+	l.clock = func() time.Time { return now }
+
+	// Before first lap line, no offset
+	if got := driveLap(l, &now, 2*time.Second); got[0] != 0.5 {
+		t.Errorf("Process() = %v, want %v", got[0], 0.5)
+	}
+
+	// First lap: learn lap duration
+	l.NewLap()
+	driveLap(l, &now, 2*time.Second)
+	l.NewLap()
+	if p := l.Profile(); p.LapDurationMs != 2000 || !reflect.DeepEqual(p.Offsets, []types.Throttle{0., 0., 0., 0.}) {
+		t.Errorf("bad profile after first lap: %v", p)
+	}
+
+	// Second lap: update profile
+	driveLap(l, &now, 2*time.Second)
+	l.NewLap()
+	want := []types.Throttle{0.1, 0.1, -0.1, 0.1}
+	if p := l.Profile(); !reflect.DeepEqual(p.Offsets, want) {
+		t.Errorf("bad profile after second lap: %v, want %v", p.Offsets, want)
+	}
+
+	// Third lap: profile is applied and offsets are bounded
+	got := driveLap(l, &now, 2*time.Second)
+	l.NewLap()
+	if !almostEqual(got[0], 0.6) || !almostEqual(got[10], 0.1) {
+		t.Errorf("profile not applied: %v", got)
+	}
+	want = []types.Throttle{0.15, 0.15, -0.2, 0.15}
+	if p := l.Profile(); !profileAlmostEqual(p.Offsets, want) {
+		t.Errorf("bad profile after third lap: %v, want %v", p.Offsets, want)
+	}
+
+	// Profile is reloaded on restart
+	l2 := NewLapLearningProcessor(NewSteeringProcessor(0.2, 0.5), testLapConfig(LapDetectionTopic, profileFile))
+	if p := l2.Profile(); p.LapDurationMs != 2000 || !profileAlmostEqual(p.Offsets, want) {
+		t.Errorf("bad profile after restart: %v", p)
+	}
+}
+
+func TestLapLearningProcessor_LoadProfile(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    LapProfile
+	}{
+		{
+			name:    "valid profile",
+			content: `{"lap_duration_ms": 2000, "offsets": [0.1, 0.15, -0.2, 0.0]}`,
+			want:    LapProfile{LapDurationMs: 2000, Offsets: []types.Throttle{0.1, 0.15, -0.2, 0.}},
+		},
+		{
+			name:    "bad segments number",
+			content: `{"lap_duration_ms": 2000, "offsets": [0.1, 0.1]}`,
+			want:    LapProfile{Offsets: []types.Throttle{0., 0., 0., 0.}},
+		},
+		{
+			name:    "offset above max offset",
+			content: `{"lap_duration_ms": 2000, "offsets": [0.1, 0.8, 0.1, 0.1]}`,
+			want:    LapProfile{Offsets: []types.Throttle{0., 0., 0., 0.}},
+		},
+		{
+			name:    "offset under min offset",
+			content: `{"lap_duration_ms": 2000, "offsets": [0.1, 0.1, -0.5, 0.1]}`,
+			want:    LapProfile{Offsets: []types.Throttle{0., 0., 0., 0.}},
+		},
+		{
+			name:    "lap too long",
+			content: `{"lap_duration_ms": 20000, "offsets": [0.1, 0.1, 0.1, 0.1]}`,
+			want:    LapProfile{Offsets: []types.Throttle{0., 0., 0., 0.}},
+		},
+		{
+			name:    "lap too short",
+			content: `{"lap_duration_ms": 0, "offsets": [0.1, 0.1, 0.1, 0.1]}`,
+			want:    LapProfile{Offsets: []types.Throttle{0., 0., 0., 0.}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profileFile := path.Join(t.TempDir(), "profile.json")
+			if err := os.WriteFile(profileFile, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("unable to write profile: %v", err)
+			}
+			l := NewLapLearningProcessor(NewSteeringProcessor(0.2, 0.5), testLapConfig(LapDetectionTopic, profileFile))
+			if p := l.Profile(); p.LapDurationMs != tt.want.LapDurationMs || !profileAlmostEqual(p.Offsets, tt.want.Offsets) {
+				t.Errorf("bad profile: %v, want %v", p, tt.want)
+			}
+		})
+	}
+}
+
+func TestLapLearningProcessor_IgnoreInvalidLaps(t *testing.T) {
+	now := time.Now()
+	l := NewLapLearningProcessor(NewSteeringProcessor(0.2, 0.5), testLapConfig(LapDetectionTopic, ""))
+	l.clock = func() time.Time { return now }
+
+	l.NewLap()
+	driveLap(l, &now, 500*time.Millisecond)
+	l.NewLap()
+	if p := l.Profile(); p.LapDurationMs != 0 {
+		t.Errorf("too short lap should be ignored: %v", p)
+	}
+
+	driveLap(l, &now, 2*time.Second)
+	now = now.Add(3 * time.Second)
+	driveLap(l, &now, 1*time.Second)
+	l.NewLap()
+	if p := l.Profile(); p.LapDurationMs != 0 {
+		t.Errorf("paused lap should be ignored: %v", p)
+	}
+}
+
+func TestLapLearningProcessor_SteeringDetection(t *testing.T) {
+	now := time.Now()
+	l := NewLapLearningProcessor(NewSteeringProcessor(0.2, 0.5), testLapConfig(LapDetectionSteering, ""))
+	l.clock = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		driveLap(l, &now, 3*time.Second)
+	}
+	p := l.Profile()
+	if p.LapDurationMs < 2900 || p.LapDurationMs > 3100 {
+		t.Errorf("bad lap duration: %v, want ~3000", p.LapDurationMs)
+	}
+	for i, o := range p.Offsets {
+		if o == 0. {
+			t.Errorf("segment %d not learnt: %v", i, p.Offsets)
+		}
+	}
+}
+
+func TestSteeringPeriod(t *testing.T) {
+	start := time.Now()
+	samples := make([]steeringSample, 0)
+	for i := 0; i < 200; i++ {
+		x := float64(i) * 0.1
+		samples = append(samples, steeringSample{
+			at:       start.Add(time.Duration(i) * 100 * time.Millisecond),
+			steering: math.Sin(2 * math.Pi * x / 4.),
+		})
+	}
+	period, found := steeringPeriod(samples, 50*time.Millisecond, 1*time.Second, 8*time.Second, 0.8)
+	if !found || period < 3900*time.Millisecond || period > 4100*time.Millisecond {
+		t.Errorf("steeringPeriod() = %v, %v, want ~4s", period, found)
+	}
+
+	constant := []steeringSample{{at: start, steering: 0.}, {at: start.Add(5 * time.Second), steering: 0.}}
+	if _, found := steeringPeriod(constant, 50*time.Millisecond, 1*time.Second, 8*time.Second, 0.8); found {
+		t.Errorf("steeringPeriod() should not find period on constant steering")
+	}
+}
+
+func TestNewLapConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name: "topic detection",
+			configContent: `{"detection": "topic", "segments": 10, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000, "profile_file": "/tmp/profile.json"}`,
+		},
+		{
+			name: "steering detection",
+			configContent: `{"detection": "steering", "segments": 10, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000, "min_correlation": 0.8}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "detection" }`,
+			wantErr:       true,
+		},
+		{
+			name: "unknown detection",
+			configContent: `{"detection": "gps", "segments": 10, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000}`,
+			wantErr: true,
+		},
+		{
+			name: "no segment",
+			configContent: `{"detection": "topic", "segments": 0, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000}`,
+			wantErr: true,
+		},
+		{
+			name: "bad offsets",
+			configContent: `{"detection": "topic", "segments": 10, "step": 0.01, "min_offset": 0.1, "max_offset": 0.2,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000}`,
+			wantErr: true,
+		},
+		{
+			name: "bad lap durations",
+			configContent: `{"detection": "topic", "segments": 10, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 60000, "max_lap_ms": 5000}`,
+			wantErr: true,
+		},
+		{
+			name: "steering detection without correlation",
+			configContent: `{"detection": "steering", "segments": 10, "step": 0.01, "min_offset": -0.1, "max_offset": 0.1,
+				"saturation_steering": 0.9, "min_lap_ms": 5000, "max_lap_ms": 60000}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewLapConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewLapConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func profileAlmostEqual(a, b []types.Throttle) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !almostEqual(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+)
+
+// Limiter restricts throttle computed by processor on PILOT mode
+type Limiter interface {
+	// Limit returns throttle allowed regarding throttle value computed by processor
+	Limit(throttle types.Throttle) types.Throttle
+}
+
+// ObjectsProcessor is implemented by processors or limiters that react to objects detected on camera frames
+type ObjectsProcessor interface {
+	SetObjects(objects *events.ObjectsMessage)
+}
@@ -0,0 +1,165 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultPIDResetTimeout = 1 * time.Second
+
+func NewPIDConfigFromJson(fileName string) (*PIDConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg PIDConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.Kp < 0. || cfg.Ki < 0. || cfg.Kd < 0. {
+		return nil, fmt.Errorf("invalid pid gains, values must be positive: kp=%v, ki=%v, kd=%v", cfg.Kp, cfg.Ki, cfg.Kd)
+	}
+	if cfg.MinThrottle < 0. || cfg.MaxThrottle > 1. || cfg.MinThrottle >= cfg.MaxThrottle {
+		return nil, fmt.Errorf("invalid throttle limits: 0.0 <= %v < %v <= 1.0", cfg.MinThrottle, cfg.MaxThrottle)
+	}
+	if cfg.IntegralLimit < 0. {
+		return nil, fmt.Errorf("invalid integral limit, value must be positive: %v", cfg.IntegralLimit)
+	}
+	if cfg.ResetTimeoutMs < 0 {
+		return nil, fmt.Errorf("invalid reset timeout, value must be >= 0: %v", cfg.ResetTimeoutMs)
+	}
+	return &cfg, nil
+}
+
+type PIDConfig struct {
+	Kp float64 `json:"kp"`
+	Ki float64 `json:"ki"`
+	Kd float64 `json:"kd"`
+	// IntegralLimit bounds the absolute contribution of the integral term, 0 means no limit
+	IntegralLimit float64        `json:"integral_limit"`
+	MinThrottle   types.Throttle `json:"min_throttle"`
+	MaxThrottle   types.Throttle `json:"max_throttle"`
+	// ResetTimeoutMs, integral and derivative terms are reset when previous computation is older, default to 1s
+	ResetTimeoutMs int `json:"reset_timeout_ms,omitempty"`
+}
+
+func (c *PIDConfig) resetTimeout() time.Duration {
+	if c.ResetTimeoutMs <= 0 {
+		return defaultPIDResetTimeout
+	}
+	return time.Duration(c.ResetTimeoutMs) * time.Millisecond
+}
+
+// NewPIDProcessor build a closed-loop processor that uses setpoint processor to compute throttle target and
+// corrects it against throttle feedback. State is reset on drive mode change and after a pause longer than reset timeout.
+func NewPIDProcessor(setpoint Processor, cfg *PIDConfig) *PIDProcessor {
+	return &PIDProcessor{
+		setpoint: setpoint,
+		cfg:      cfg,
+		clock:    time.Now,
+	}
+}
+
+type PIDProcessor struct {
+	setpoint Processor
+	cfg      *PIDConfig
+	clock    func() time.Time
+
+	muRealThrottle sync.RWMutex
+	realThrottle   types.Throttle
+
+	muState   sync.Mutex
+	driveMode events.DriveMode
+	integral  float64
+	lastError float64
+	lastTime  time.Time
+}
+
+func (p *PIDProcessor) SetRealThrottle(t types.Throttle) {
+	p.muRealThrottle.Lock()
+	defer p.muRealThrottle.Unlock()
+	p.realThrottle = t
+}
+
+func (p *PIDProcessor) RealThrottle() types.Throttle {
+	p.muRealThrottle.RLock()
+	defer p.muRealThrottle.RUnlock()
+	return p.realThrottle
+}
+
+func (p *PIDProcessor) SetSpeedZone(sz events.SpeedZone) {
+	p.setpoint.SetSpeedZone(sz)
+}
+
+// SetDriveMode resets integral and derivative terms when drive mode changes
+func (p *PIDProcessor) SetDriveMode(dm events.DriveMode) {
+	if dp, ok := p.setpoint.(DriveModeProcessor); ok {
+		dp.SetDriveMode(dm)
+	}
+
+	p.muState.Lock()
+	defer p.muState.Unlock()
+	if dm != p.driveMode {
+		p.reset()
+	}
+	p.driveMode = dm
+}
+
+// reset must be called with muState lock held
+func (p *PIDProcessor) reset() {
+	p.integral = 0.
+	p.lastError = 0.
+	p.lastTime = time.Time{}
+}
+
+// Process compute throttle target from steering value and correct it with throttle feedback
+func (p *PIDProcessor) Process(steering types.Steering) types.Throttle {
+	target := p.setpoint.Process(steering)
+	e := float64(target - p.RealThrottle())
+
+	p.muState.Lock()
+	defer p.muState.Unlock()
+
+	now := p.clock()
+	if !p.lastTime.IsZero() && now.Sub(p.lastTime) > p.cfg.resetTimeout() {
+		// Processor wasn't called for a while, previous state is meaningless
+		p.reset()
+	}
+	dt := 0.
+	if !p.lastTime.IsZero() {
+		dt = now.Sub(p.lastTime).Seconds()
+	}
+	derivative := 0.
+	if dt > 0. {
+		derivative = (e - p.lastError) / dt
+	}
+
+	integral := p.limitIntegral(p.integral + e*dt)
+	output := float64(target) + p.cfg.Kp*e + p.cfg.Ki*integral + p.cfg.Kd*derivative
+
+	// Anti-windup: freeze integral when output is saturated and error pushes in the same direction
+	saturatedHigh := output > float64(p.cfg.MaxThrottle) && e > 0.
+	saturatedLow := output < float64(p.cfg.MinThrottle) && e < 0.
+	if !saturatedHigh && !saturatedLow {
+		p.integral = integral
+	}
+	p.lastError = e
+	p.lastTime = now
+
+	return types.Throttle(math.Max(float64(p.cfg.MinThrottle), math.Min(float64(p.cfg.MaxThrottle), output)))
+}
+
+func (p *PIDProcessor) limitIntegral(integral float64) float64 {
+	if p.cfg.IntegralLimit <= 0. || p.cfg.Ki <= 0. {
+		return integral
+	}
+	limit := p.cfg.IntegralLimit / p.cfg.Ki
+	return math.Max(-limit, math.Min(limit, integral))
+}
@@ -0,0 +1,286 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPIDProcessor_Process(t *testing.T) {
+	type fields struct {
+		cfg          PIDConfig
+		realThrottle types.Throttle
+		integral     float64
+		lastError    float64
+	}
+	type args struct {
+		steering types.Steering
+		dt       time.Duration
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   types.Throttle
+	}{
+		{
+			name: "no gain, use setpoint",
+			fields: fields{
+				cfg:          PIDConfig{MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.2,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.5,
+		},
+		{
+			name: "real throttle too low, proportional correction",
+			fields: fields{
+				cfg:          PIDConfig{Kp: 1., MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.3,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.7,
+		},
+		{
+			name: "real throttle too high, proportional correction",
+			fields: fields{
+				cfg:          PIDConfig{Kp: 1., MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.6,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.4,
+		},
+		{
+			name: "integral correction",
+			fields: fields{
+				cfg:          PIDConfig{Ki: 1., MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.3,
+				integral:     0.1,
+			},
+			args: args{steering: 0., dt: 500 * time.Millisecond},
+			want: 0.7,
+		},
+		{
+			name: "integral limited",
+			fields: fields{
+				cfg:          PIDConfig{Ki: 1., IntegralLimit: 0.05, MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.3,
+				integral:     0.1,
+			},
+			args: args{steering: 0., dt: 500 * time.Millisecond},
+			want: 0.55,
+		},
+		{
+			name: "derivative correction",
+			fields: fields{
+				cfg:          PIDConfig{Kd: 0.1, MinThrottle: 0., MaxThrottle: 1.},
+				realThrottle: 0.4,
+				lastError:    0.,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.6,
+		},
+		{
+			name: "output clamped to max throttle",
+			fields: fields{
+				cfg:          PIDConfig{Kp: 2., MinThrottle: 0.1, MaxThrottle: 0.6},
+				realThrottle: 0.,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.6,
+		},
+		{
+			name: "output clamped to min throttle",
+			fields: fields{
+				cfg:          PIDConfig{Kp: 2., MinThrottle: 0.1, MaxThrottle: 0.6},
+				realThrottle: 1.,
+			},
+			args: args{steering: 0., dt: 100 * time.Millisecond},
+			want: 0.1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			p := NewPIDProcessor(NewSteeringProcessor(0., 0.5), &tt.fields.cfg)
+			p.clock = func() time.Time { return now }
+			p.lastTime = now.Add(-1 * tt.args.dt)
+			p.integral = tt.fields.integral
+			p.lastError = tt.fields.lastError
+			p.SetRealThrottle(tt.fields.realThrottle)
+
+			if got := p.Process(tt.args.steering); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPIDProcessor_AntiWindup(t *testing.T) {
+	now := time.Now()
+	p := NewPIDProcessor(NewSteeringProcessor(0., 0.5), &PIDConfig{Ki: 1., MinThrottle: 0., MaxThrottle: 0.6})
+	p.clock = func() time.Time { return now }
+	p.SetRealThrottle(0.)
+
+	for i := 0; i < 20; i++ {
+		now = now.Add(1 * time.Second)
+		p.Process(0.)
+	}
+	if p.integral > 0.11 {
+		t.Errorf("integral should stop to grow when output is saturated: %v", p.integral)
+	}
+
+	// Once feedback reach target, output must come back quickly to setpoint
+	p.SetRealThrottle(0.5)
+	now = now.Add(1 * time.Second)
+	if got := p.Process(0.); got > 0.61 {
+		t.Errorf("Process() = %v, want <= 0.6", got)
+	}
+}
+
+func TestPIDProcessor_Reset(t *testing.T) {
+	cfg := PIDConfig{Ki: 1., Kd: 0.1, MinThrottle: 0., MaxThrottle: 1.}
+	tests := []struct {
+		name  string
+		reset func(p *PIDProcessor, now *time.Time)
+	}{
+		{
+			name:  "long pause",
+			reset: func(_ *PIDProcessor, now *time.Time) { *now = now.Add(10 * time.Second) },
+		},
+		{
+			name: "drive mode change",
+			reset: func(p *PIDProcessor, now *time.Time) {
+				p.SetDriveMode(events.DriveMode_USER)
+				*now = now.Add(100 * time.Millisecond)
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			p := NewPIDProcessor(NewSteeringProcessor(0., 0.5), &cfg)
+			p.clock = func() time.Time { return now }
+			p.SetRealThrottle(0.4)
+			p.SetDriveMode(events.DriveMode_PILOT)
+			for i := 0; i < 5; i++ {
+				now = now.Add(100 * time.Millisecond)
+				p.Process(0.)
+			}
+
+			tt.reset(p, &now)
+			// First computation after reset only uses setpoint, dt is unknown
+			if got := p.Process(0.); !almostEqual(got, 0.5) {
+				t.Errorf("Process() = %v, want %v", got, 0.5)
+			}
+			if p.integral != 0. {
+				t.Errorf("integral should be reset: %v", p.integral)
+			}
+		})
+	}
+}
+
+func TestPIDProcessor_SameDriveMode(t *testing.T) {
+	now := time.Now()
+	p := NewPIDProcessor(NewSteeringProcessor(0., 0.5), &PIDConfig{Ki: 1., MinThrottle: 0., MaxThrottle: 1.})
+	p.clock = func() time.Time { return now }
+	p.SetRealThrottle(0.)
+	p.SetDriveMode(events.DriveMode_PILOT)
+
+	for i := 0; i < 10; i++ {
+		now = now.Add(100 * time.Millisecond)
+		// Drive mode is published again between ticks
+		p.SetDriveMode(events.DriveMode_PILOT)
+		p.Process(0.)
+	}
+	// First tick has no dt, then 9 ticks of 0.5 error during 100ms
+	if math.Abs(p.integral-0.45) > 0.0001 {
+		t.Errorf("integral shouldn't be reset by same drive mode: %v, want %v", p.integral, 0.45)
+	}
+}
+
+func TestNewPIDConfigFromJson(t *testing.T) {
+	type args struct {
+		configContent string
+	}
+
+	tests := []struct {
+		name    string
+		args    args
+		want    *PIDConfig
+		wantErr bool
+	}{
+		{
+			name: "default",
+			args: args{
+				configContent: `{
+	"kp": 0.5,
+	"ki": 0.1,
+	"kd": 0.05,
+	"integral_limit": 0.2,
+	"min_throttle": 0.1,
+	"max_throttle": 0.8
+}
+`,
+			},
+			want: &PIDConfig{Kp: 0.5, Ki: 0.1, Kd: 0.05, IntegralLimit: 0.2, MinThrottle: 0.1, MaxThrottle: 0.8},
+		},
+		{
+			name:    "invalid config",
+			args:    args{configContent: `{ "kp" }`},
+			wantErr: true,
+		},
+		{
+			name:    "negative gain",
+			args:    args{configContent: `{"kp": -0.5, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+		{
+			name:    "bad throttle limits",
+			args:    args{configContent: `{"kp": 0.5, "min_throttle": 0.8, "max_throttle": 0.1}`},
+			wantErr: true,
+		},
+		{
+			name:    "max throttle > 1",
+			args:    args{configContent: `{"kp": 0.5, "min_throttle": 0.1, "max_throttle": 1.1}`},
+			wantErr: true,
+		},
+		{
+			name:    "negative integral limit",
+			args:    args{configContent: `{"kp": 0.5, "integral_limit": -1, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+		{
+			name:    "negative reset timeout",
+			args:    args{configContent: `{"kp": 0.5, "reset_timeout_ms": -1, "min_throttle": 0.1, "max_throttle": 0.8}`},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.args.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			got, err := NewPIDConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPIDConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPIDConfigFromJson() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func almostEqual(a, b types.Throttle) bool {
+	d := a - b
+	return d < 0.0001 && d > -0.0001
+}
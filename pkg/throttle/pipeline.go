@@ -0,0 +1,231 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"os"
+)
+
+type Operator string
+
+const (
+	OperatorMin             Operator = "min"
+	OperatorMax             Operator = "max"
+	OperatorWeightedAverage Operator = "weighted_average"
+	OperatorMultiply        Operator = "multiply"
+)
+
+type StageType string
+
+const (
+	StageSteering       StageType = "steering"
+	StageSpeedZone      StageType = "speed_zone"
+	StageCustomSteering StageType = "custom_steering"
+	StagePipeline       StageType = "pipeline"
+)
+
+type PipelineConfig struct {
+	Operator Operator         `json:"operator"`
+	Stages   []*PipelineStage `json:"stages"`
+}
+
+type PipelineStage struct {
+	Type StageType `json:"type"`
+	// Weight of stage output when operator is weighted_average, default to 1
+	Weight *float64 `json:"weight,omitempty"`
+	// Min and Max clamp stage output
+	Min *types.Throttle `json:"min,omitempty"`
+	Max *types.Throttle `json:"max,omitempty"`
+
+	// steering stage
+	MinThrottle types.Throttle `json:"min_throttle,omitempty"`
+	MaxThrottle types.Throttle `json:"max_throttle,omitempty"`
+
+	// speed_zone stage
+	SlowThrottle     types.Throttle `json:"slow_throttle,omitempty"`
+	NormalThrottle   types.Throttle `json:"normal_throttle,omitempty"`
+	FastThrottle     types.Throttle `json:"fast_throttle,omitempty"`
+	ModerateSteering float64        `json:"moderate_steering,omitempty"`
+	FullSteering     float64        `json:"full_steering,omitempty"`
+
+	// custom_steering stage, curve is defined inline or in a separate json file
+	Curve  *Config `json:"curve,omitempty"`
+	Config string  `json:"config,omitempty"`
+
+	// pipeline stage
+	Pipeline *PipelineConfig `json:"pipeline,omitempty"`
+}
+
+func NewPipelineProcessorFromJson(fileName string) (*PipelineProcessor, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg PipelineConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	return NewPipelineProcessor(&cfg)
+}
+
+// NewPipelineProcessor build a processor that combines outputs of several processors
+func NewPipelineProcessor(cfg *PipelineConfig) (*PipelineProcessor, error) {
+	switch cfg.Operator {
+	case OperatorMin, OperatorMax, OperatorWeightedAverage, OperatorMultiply:
+	default:
+		return nil, fmt.Errorf("invalid operator '%v', accepted values: %v, %v, %v, %v", cfg.Operator,
+			OperatorMin, OperatorMax, OperatorWeightedAverage, OperatorMultiply)
+	}
+	if len(cfg.Stages) == 0 {
+		return nil, fmt.Errorf("invalid pipeline, none stage")
+	}
+
+	stages := make([]*pipelineStage, 0, len(cfg.Stages))
+	totalWeight := 0.
+	for idx, s := range cfg.Stages {
+		stage, err := newPipelineStage(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stage %d (%v): %w", idx, s.Type, err)
+		}
+		totalWeight += stage.weight
+		stages = append(stages, stage)
+	}
+	if cfg.Operator == OperatorWeightedAverage && totalWeight <= 0. {
+		return nil, fmt.Errorf("invalid pipeline, sum of weights must be > 0: %v", totalWeight)
+	}
+	return &PipelineProcessor{
+		operator: cfg.Operator,
+		stages:   stages,
+	}, nil
+}
+
+func newPipelineStage(s *PipelineStage) (*pipelineStage, error) {
+	stage := pipelineStage{weight: 1., min: 0., max: 1.}
+	if s.Weight != nil {
+		if *s.Weight < 0. {
+			return nil, fmt.Errorf("invalid weight, value must be positive: %v", *s.Weight)
+		}
+		stage.weight = *s.Weight
+	}
+	if s.Min != nil {
+		stage.min = *s.Min
+	}
+	if s.Max != nil {
+		stage.max = *s.Max
+	}
+	if stage.min < 0. || stage.max > 1. || stage.min > stage.max {
+		return nil, fmt.Errorf("invalid clamp: 0.0 <= %v <= %v <= 1.0", stage.min, stage.max)
+	}
+
+	switch s.Type {
+	case StageSteering:
+		if s.MinThrottle < 0. || s.MaxThrottle > 1. || s.MinThrottle >= s.MaxThrottle {
+			return nil, fmt.Errorf("invalid min_throttle/max_throttle: 0.0 <= %v < %v <= 1.0", s.MinThrottle,
+				s.MaxThrottle)
+		}
+		stage.processor = NewSteeringProcessor(s.MinThrottle, s.MaxThrottle)
+	case StageSpeedZone:
+		if s.SlowThrottle <= 0. || s.SlowThrottle > s.NormalThrottle || s.NormalThrottle > s.FastThrottle ||
+			s.FastThrottle > 1. {
+			return nil, fmt.Errorf("invalid slow/normal/fast throttle: 0.0 < %v <= %v <= %v <= 1.0", s.SlowThrottle,
+				s.NormalThrottle, s.FastThrottle)
+		}
+		if s.ModerateSteering <= 0. || s.ModerateSteering >= s.FullSteering || s.FullSteering > 1. {
+			return nil, fmt.Errorf("invalid moderate/full steering: 0.0 < %v < %v <= 1.0", s.ModerateSteering,
+				s.FullSteering)
+		}
+		stage.processor = NewSpeedZoneProcessor(s.SlowThrottle, s.NormalThrottle, s.FastThrottle,
+			s.ModerateSteering, s.FullSteering)
+	case StageCustomSteering:
+		cfg := s.Curve
+		if s.Config != "" {
+			c, err := NewConfigFromJson(s.Config)
+			if err != nil {
+				return nil, err
+			}
+			cfg = c
+		} else if cfg == nil {
+			return nil, fmt.Errorf("curve or config must be defined")
+		} else if err := cfg.validate(); err != nil {
+			return nil, err
+		}
+		stage.processor = NewCustomSteeringProcessor(cfg)
+	case StagePipeline:
+		if s.Pipeline == nil {
+			return nil, fmt.Errorf("pipeline must be defined")
+		}
+		p, err := NewPipelineProcessor(s.Pipeline)
+		if err != nil {
+			return nil, err
+		}
+		stage.processor = p
+	default:
+		return nil, fmt.Errorf("unknown stage type '%v', accepted values: %v, %v, %v, %v", s.Type,
+			StageSteering, StageSpeedZone, StageCustomSteering, StagePipeline)
+	}
+	return &stage, nil
+}
+
+type pipelineStage struct {
+	processor Processor
+	weight    float64
+	min, max  types.Throttle
+}
+
+func (s *pipelineStage) process(steering types.Steering) types.Throttle {
+	t := s.processor.Process(steering)
+	if t < s.min {
+		return s.min
+	}
+	if t > s.max {
+		return s.max
+	}
+	return t
+}
+
+type PipelineProcessor struct {
+	operator Operator
+	stages   []*pipelineStage
+}
+
+// Process compute throttle of each stage and combine them with pipeline operator
+func (p *PipelineProcessor) Process(steering types.Steering) types.Throttle {
+	switch p.operator {
+	case OperatorMin:
+		result := math.MaxFloat64
+		for _, s := range p.stages {
+			result = math.Min(result, float64(s.process(steering)))
+		}
+		return types.Throttle(result)
+	case OperatorMax:
+		result := -math.MaxFloat64
+		for _, s := range p.stages {
+			result = math.Max(result, float64(s.process(steering)))
+		}
+		return types.Throttle(result)
+	case OperatorWeightedAverage:
+		sum, totalWeight := 0., 0.
+		for _, s := range p.stages {
+			sum += s.weight * float64(s.process(steering))
+			totalWeight += s.weight
+		}
+		return types.Throttle(sum / totalWeight)
+	case OperatorMultiply:
+		result := 1.
+		for _, s := range p.stages {
+			result *= float64(s.process(steering))
+		}
+		return types.Throttle(result)
+	}
+	return 0.
+}
+
+func (p *PipelineProcessor) SetSpeedZone(sz events.SpeedZone) {
+	for _, s := range p.stages {
+		s.processor.SetSpeedZone(sz)
+	}
+}
@@ -0,0 +1,237 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPipelineProcessor_Process(t *testing.T) {
+	type args struct {
+		speedZone events.SpeedZone
+		steering  types.Steering
+	}
+	tests := []struct {
+		name          string
+		configContent string
+		args          args
+		want          types.Throttle
+	}{
+		{
+			name: "min, speed zone capped by steering curve",
+			configContent: `{
+	"operator": "min",
+	"stages": [
+		{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8},
+		{"type": "custom_steering", "curve": {"steering_values": [0.0, 0.2], "throttle_steps": [0.9, 0.6]}}
+	]
+}`,
+			args: args{speedZone: events.SpeedZone_FAST, steering: 0.3},
+			want: 0.6,
+		},
+		{
+			name: "max",
+			configContent: `{
+	"operator": "max",
+	"stages": [
+		{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4},
+		{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8}
+	]
+}`,
+			args: args{speedZone: events.SpeedZone_SLOW, steering: 0.},
+			want: 0.4,
+		},
+		{
+			name: "weighted average",
+			configContent: `{
+	"operator": "weighted_average",
+	"stages": [
+		{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4, "weight": 3},
+		{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8}
+	]
+}`,
+			args: args{speedZone: events.SpeedZone_FAST, steering: 0.},
+			want: 0.5,
+		},
+		{
+			name: "weighted average, default weight",
+			configContent: `{
+	"operator": "weighted_average",
+	"stages": [
+		{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4},
+		{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8}
+	]
+}`,
+			args: args{speedZone: events.SpeedZone_FAST, steering: 0.},
+			want: 0.6,
+		},
+		{
+			name: "multiply",
+			configContent: `{
+	"operator": "multiply",
+	"stages": [
+		{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8},
+		{"type": "steering", "min_throttle": 0.0, "max_throttle": 1.0}
+	]
+}`,
+			args: args{speedZone: events.SpeedZone_FAST, steering: 0.5},
+			want: 0.25,
+		},
+		{
+			name: "stage clamps",
+			configContent: `{
+	"operator": "max",
+	"stages": [
+		{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.9, "max": 0.7},
+		{"type": "steering", "min_throttle": 0.0, "max_throttle": 0.1, "min": 0.3}
+	]
+}`,
+			args: args{steering: 0.},
+			want: 0.7,
+		},
+		{
+			name: "nested pipeline",
+			configContent: `{
+	"operator": "min",
+	"stages": [
+		{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.9},
+		{"type": "pipeline", "pipeline": {
+			"operator": "max",
+			"stages": [
+				{"type": "steering", "min_throttle": 0.1, "max_throttle": 0.3},
+				{"type": "steering", "min_throttle": 0.1, "max_throttle": 0.5}
+			]
+		}}
+	]
+}`,
+			args: args{steering: 0.},
+			want: 0.5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "pipeline.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			p, err := NewPipelineProcessorFromJson(configName)
+			if err != nil {
+				t.Fatalf("unable to build pipeline: %v", err)
+			}
+			p.SetSpeedZone(tt.args.speedZone)
+			if got := p.Process(tt.args.steering); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPipelineProcessorFromJson(t *testing.T) {
+	steeringConfig := path.Join(t.TempDir(), "steering.json")
+	err := os.WriteFile(steeringConfig, []byte(`{"steering_values": [0.0, 0.5], "throttle_steps": [0.9, 0.6]}`), 0644)
+	if err != nil {
+		t.Errorf("unable to create test config: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "custom steering from config file",
+			configContent: `{"operator": "min", "stages": [{"type": "custom_steering", "config": "` + steeringConfig + `"}]}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "operator" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "unknown operator",
+			configContent: `{"operator": "sum", "stages": [{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "no stage",
+			configContent: `{"operator": "min", "stages": []}`,
+			wantErr:       true,
+		},
+		{
+			name:          "unknown stage",
+			configContent: `{"operator": "min", "stages": [{"type": "foo"}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "bad clamps",
+			configContent: `{"operator": "min", "stages": [{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4, "min": 0.5, "max": 0.3}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "negative weight",
+			configContent: `{"operator": "weighted_average", "stages": [{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4, "weight": -1}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "null weights",
+			configContent: `{"operator": "weighted_average", "stages": [{"type": "steering", "min_throttle": 0.2, "max_throttle": 0.4, "weight": 0}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "steering without throttle limits",
+			configContent: `{"operator": "min", "stages": [{"type": "steering"}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "steering with bad throttle limits",
+			configContent: `{"operator": "min", "stages": [{"type": "steering", "min_throttle": 0.4, "max_throttle": 0.2}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "speed zone without throttles",
+			configContent: `{"operator": "min", "stages": [{"type": "speed_zone", "moderate_steering": 0.4, "full_steering": 0.8}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "speed zone with unordered throttles",
+			configContent: `{"operator": "min", "stages": [{"type": "speed_zone", "slow_throttle": 0.5, "normal_throttle": 0.2, "fast_throttle": 0.8, "moderate_steering": 0.4, "full_steering": 0.8}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "speed zone without steering thresholds",
+			configContent: `{"operator": "min", "stages": [{"type": "speed_zone", "slow_throttle": 0.2, "normal_throttle": 0.5, "fast_throttle": 0.8}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "custom steering without curve",
+			configContent: `{"operator": "min", "stages": [{"type": "custom_steering"}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "custom steering with invalid curve",
+			configContent: `{"operator": "min", "stages": [{"type": "custom_steering", "curve": {"steering_values": [0.0, 0.5], "throttle_steps": [0.6, 0.9]}}]}`,
+			wantErr:       true,
+		},
+		{
+			name:          "invalid nested pipeline",
+			configContent: `{"operator": "min", "stages": [{"type": "pipeline", "pipeline": {"operator": "min", "stages": []}}]}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "pipeline.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewPipelineProcessorFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewPipelineProcessorFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
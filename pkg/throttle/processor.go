@@ -8,6 +8,7 @@ import (
 	"math"
 	"os"
 	"sync"
+	"time"
 )
 
 type Processor interface {
@@ -17,6 +18,11 @@ type Processor interface {
 	SetSpeedZone(sz events.SpeedZone)
 }
 
+// FeedbackProcessor is implemented by processors that need the throttle really applied by the ESC
+type FeedbackProcessor interface {
+	SetRealThrottle(t types.Throttle)
+}
+
 func NewSteeringProcessor(minThrottle, maxThrottle types.Throttle) *SteeringProcessor {
 	return &SteeringProcessor{
 		minThrottle: minThrottle,
@@ -38,24 +44,96 @@ func (sp *SteeringProcessor) Process(steering types.Steering) types.Throttle {
 	return sp.minThrottle + types.Throttle(float64(sp.maxThrottle-sp.minThrottle)*(1-absSteering))
 }
 
+// NewSpeedZoneProcessor build a processor with a steering table by speed zone equivalent to:
+//   - FAST zone: fastThrottle, normalThrottle above moderateSteering, slowThrottle above fullSteering
+//   - NORMAL zone: normalThrottle, slowThrottle above fullSteering
+//   - SLOW and UNKNOWN zones: slowThrottle
 func NewSpeedZoneProcessor(slowThrottle, normalThrottle, fastThrottle types.Throttle,
-	moderateSteering, fullSteering float64) *SpeedZoneProcessor {
-	return &SpeedZoneProcessor{
-		muSz:             sync.Mutex{},
-		speedZone:        events.SpeedZone_UNKNOWN,
-		slowThrottle:     slowThrottle,
-		normalThrottle:   normalThrottle,
-		fastThrottle:     fastThrottle,
-		moderateSteering: moderateSteering,
-		fullSteering:     fullSteering,
+	moderateSteering, fullSteering float64, opts ...SpeedZoneOption) *SpeedZoneProcessor {
+	slow := Config{
+		SteeringValues: []types.Steering{0.},
+		ThrottleSteps:  []types.Throttle{slowThrottle},
+	}
+	return NewSpeedZoneProcessorWithConfig(&SpeedZoneConfig{
+		Unknown: &slow,
+		Slow:    &slow,
+		Normal: &Config{
+			// Slow throttle only when steering is strictly greater than full steering
+			SteeringValues: []types.Steering{0., types.Steering(math.Nextafter32(float32(fullSteering), 2.))},
+			ThrottleSteps:  []types.Throttle{normalThrottle, slowThrottle},
+		},
+		Fast: &Config{
+			SteeringValues: []types.Steering{0., types.Steering(moderateSteering), types.Steering(fullSteering)},
+			ThrottleSteps:  []types.Throttle{fastThrottle, normalThrottle, slowThrottle},
+		},
+	}, opts...)
+}
+
+func NewSpeedZoneProcessorWithConfig(cfg *SpeedZoneConfig, opts ...SpeedZoneOption) *SpeedZoneProcessor {
+	sp := &SpeedZoneProcessor{
+		muSz:      sync.Mutex{},
+		speedZone: events.SpeedZone_UNKNOWN,
+		curves: map[events.SpeedZone]*Config{
+			events.SpeedZone_UNKNOWN: cfg.Unknown,
+			events.SpeedZone_SLOW:    cfg.Slow,
+			events.SpeedZone_NORMAL:  cfg.Normal,
+			events.SpeedZone_FAST:    cfg.Fast,
+		},
+		clock: time.Now,
+	}
+	for _, o := range opts {
+		o(sp)
+	}
+	return sp
+}
+
+type SpeedZoneOption func(sp *SpeedZoneProcessor)
+
+// ZoneDebounce defines conditions to accept a new speed zone: a number of consistent messages or a minimum dwell
+// time since first message. Zero values are ignored, zone is accepted immediately if none condition is set.
+type ZoneDebounce struct {
+	Messages int
+	Dwell    time.Duration
+}
+
+func (d ZoneDebounce) accept(messages int, dwell time.Duration) bool {
+	if d.Messages <= 0 && d.Dwell <= 0 {
+		return true
+	}
+	return (d.Messages > 0 && messages >= d.Messages) || (d.Dwell > 0 && dwell >= d.Dwell)
+}
+
+// WithSpeedZoneDebounce filters flickering speed zones, upgrades (to a faster zone) and downgrades can be configured
+// independently
+func WithSpeedZoneDebounce(upgrade, downgrade ZoneDebounce) SpeedZoneOption {
+	return func(sp *SpeedZoneProcessor) {
+		sp.upgrade = upgrade
+		sp.downgrade = downgrade
+	}
+}
+
+// WithSpeedZoneRamp limits throttle variation to rate (throttle unit by second) after a zone change
+func WithSpeedZoneRamp(rate float64) SpeedZoneOption {
+	return func(sp *SpeedZoneProcessor) {
+		sp.rampRate = rate
 	}
 }
 
 type SpeedZoneProcessor struct {
-	muSz                                       sync.Mutex
-	speedZone                                  events.SpeedZone
-	slowThrottle, normalThrottle, fastThrottle types.Throttle
-	moderateSteering, fullSteering             float64
+	muSz      sync.Mutex
+	speedZone events.SpeedZone
+	curves    map[events.SpeedZone]*Config
+	clock     func() time.Time
+
+	upgrade, downgrade ZoneDebounce
+	pendingZone        events.SpeedZone
+	pendingMessages    int
+	pendingSince       time.Time
+
+	rampRate    float64
+	ramping     bool
+	lastOutput  types.Throttle
+	lastProcess time.Time
 }
 
 func (sp *SpeedZoneProcessor) SpeedZone() events.SpeedZone {
@@ -67,30 +145,103 @@ func (sp *SpeedZoneProcessor) SpeedZone() events.SpeedZone {
 func (sp *SpeedZoneProcessor) SetSpeedZone(sz events.SpeedZone) {
 	sp.muSz.Lock()
 	defer sp.muSz.Unlock()
+
+	if sz == sp.speedZone {
+		sp.pendingMessages = 0
+		return
+	}
+
+	now := sp.clock()
+	if sp.pendingMessages == 0 || sz != sp.pendingZone {
+		sp.pendingZone = sz
+		sp.pendingMessages = 0
+		sp.pendingSince = now
+	}
+	sp.pendingMessages++
+
+	debounce := sp.downgrade
+	if zoneRank(sz) > zoneRank(sp.speedZone) {
+		debounce = sp.upgrade
+	}
+	if !debounce.accept(sp.pendingMessages, now.Sub(sp.pendingSince)) {
+		return
+	}
+
 	sp.speedZone = sz
+	sp.pendingMessages = 0
+	sp.ramping = sp.rampRate > 0.
+}
+
+func zoneRank(sz events.SpeedZone) int {
+	switch sz {
+	case events.SpeedZone_SLOW:
+		return 1
+	case events.SpeedZone_NORMAL:
+		return 2
+	case events.SpeedZone_FAST:
+		return 3
+	}
+	return 0
 }
 
 // Process compute throttle from steering value
 func (sp *SpeedZoneProcessor) Process(steering types.Steering) types.Throttle {
-	st := math.Abs(float64(steering))
+	sp.muSz.Lock()
+	defer sp.muSz.Unlock()
 
-	switch sp.SpeedZone() {
-	case events.SpeedZone_FAST:
-		if st >= sp.fullSteering {
-			return sp.slowThrottle
-		} else if st >= sp.moderateSteering {
-			return sp.normalThrottle
+	curve, ok := sp.curves[sp.speedZone]
+	if !ok {
+		curve = sp.curves[events.SpeedZone_UNKNOWN]
+	}
+	target := curve.ValueOf(steering)
+
+	now := sp.clock()
+	output := target
+	if sp.ramping && !sp.lastProcess.IsZero() {
+		maxStep := types.Throttle(sp.rampRate * now.Sub(sp.lastProcess).Seconds())
+		if target > sp.lastOutput+maxStep {
+			output = sp.lastOutput + maxStep
+		} else if target < sp.lastOutput-maxStep {
+			output = sp.lastOutput - maxStep
+		} else {
+			sp.ramping = false
 		}
-		return sp.fastThrottle
-	case events.SpeedZone_NORMAL:
-		if st > sp.fullSteering {
-			return sp.slowThrottle
+	}
+	sp.lastOutput = output
+	sp.lastProcess = now
+	return output
+}
+
+func NewSpeedZoneConfigFromJson(fileName string) (*SpeedZoneConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg SpeedZoneConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	for _, zc := range []struct {
+		name string
+		cfg  *Config
+	}{{"unknown", cfg.Unknown}, {"slow", cfg.Slow}, {"normal", cfg.Normal}, {"fast", cfg.Fast}} {
+		if zc.cfg == nil {
+			return nil, fmt.Errorf("invalid configuration, missing %v zone", zc.name)
+		}
+		if err := zc.cfg.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %v zone: %w", zc.name, err)
 		}
-		return sp.normalThrottle
-	case events.SpeedZone_SLOW:
-		return sp.slowThrottle
 	}
-	return sp.slowThrottle
+	return &cfg, nil
+}
+
+// SpeedZoneConfig defines steering table to use for each speed zone
+type SpeedZoneConfig struct {
+	Unknown *Config `json:"unknown"`
+	Slow    *Config `json:"slow"`
+	Normal  *Config `json:"normal"`
+	Fast    *Config `json:"fast"`
 }
 
 func NewCustomSteeringProcessor(cfg *Config) *CustomSteeringProcessor {
@@ -126,39 +277,80 @@ func NewConfigFromJson(fileName string) (*Config, error) {
 	if err != nil {
 		return &emptyConfig, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
 	}
-	if len(ft.SteeringValues) == 0 {
-		return &emptyConfig, fmt.Errorf("invalid configuration, none steering value'")
+	if err := ft.validate(); err != nil {
+		return &emptyConfig, err
 	}
-	if len(ft.SteeringValues) != len(ft.ThrottleSteps) {
-		return &emptyConfig, fmt.Errorf("invalid config, steering value number must be equals "+
-			"to throttle value number: %v/%v", len(ft.SteeringValues), len(ft.ThrottleSteps))
+	return &ft, nil
+}
+
+type Interpolation string
+
+const (
+	// InterpolationStep keeps throttle constant until next steering value is reached
+	InterpolationStep Interpolation = "step"
+	// InterpolationLinear draws straight lines between points
+	InterpolationLinear Interpolation = "linear"
+	// InterpolationPCHIP uses a monotone cubic (Fritsch-Carlson) curve between points
+	InterpolationPCHIP Interpolation = "pchip"
+)
+
+type Config struct {
+	SteeringValues []types.Steering `json:"steering_values"`
+	ThrottleSteps  []types.Throttle `json:"throttle_steps"`
+	// Interpolation between points, default to InterpolationStep
+	Interpolation Interpolation `json:"interpolation,omitempty"`
+}
+
+func (tc *Config) validate() error {
+	if len(tc.SteeringValues) == 0 {
+		return fmt.Errorf("invalid configuration, none steering value'")
+	}
+	if len(tc.SteeringValues) != len(tc.ThrottleSteps) {
+		return fmt.Errorf("invalid config, steering value number must be equals "+
+			"to throttle value number: %v/%v", len(tc.SteeringValues), len(tc.ThrottleSteps))
 	}
 	lastT := types.Throttle(1.)
-	for _, t := range ft.ThrottleSteps {
+	for _, t := range tc.ThrottleSteps {
 		if t < 0. || t > 1. {
-			return &emptyConfig, fmt.Errorf("invalid throttle value: 0.0 < %v <= 1.0", t)
+			return fmt.Errorf("invalid throttle value: 0.0 < %v <= 1.0", t)
 		}
 		if t >= lastT {
-			return &emptyConfig, fmt.Errorf("invalid throttle value, all values must be decreasing: %v <= %v", lastT, t)
+			return fmt.Errorf("invalid throttle value, all values must be decreasing: %v <= %v", lastT, t)
 		}
 		lastT = t
 	}
 	lastS := types.Steering(-0.001)
-	for _, s := range ft.SteeringValues {
+	for _, s := range tc.SteeringValues {
 		if s < 0. || s > 1. {
-			return &emptyConfig, fmt.Errorf("invalid steering value: 0.0 < %v <= 1.0", s)
+			return fmt.Errorf("invalid steering value: 0.0 < %v <= 1.0", s)
 		}
 		if s <= lastS {
-			return &emptyConfig, fmt.Errorf("invalid steering value, all values must be increasing: %v <= %v", lastS, s)
+			return fmt.Errorf("invalid steering value, all values must be increasing: %v <= %v", lastS, s)
 		}
 		lastS = s
 	}
-	return &ft, nil
-}
+	switch tc.Interpolation {
+	case "", InterpolationStep, InterpolationLinear, InterpolationPCHIP:
+	default:
+		return fmt.Errorf("invalid interpolation '%v', accepted values: %v, %v, %v", tc.Interpolation,
+			InterpolationStep, InterpolationLinear, InterpolationPCHIP)
+	}
 
-type Config struct {
-	SteeringValues []types.Steering `json:"steering_values"`
-	ThrottleSteps  []types.Throttle `json:"throttle_steps"`
+	// Check curve between points is also decreasing
+	samples := 100
+	lastValue := tc.ValueOf(0.)
+	for i := 1; i <= samples; i++ {
+		s := types.Steering(float64(i) / float64(samples))
+		v := tc.ValueOf(s)
+		if v < 0. || v > 1. {
+			return fmt.Errorf("invalid interpolated throttle value at steering %v: 0.0 < %v <= 1.0", s, v)
+		}
+		if v > lastValue {
+			return fmt.Errorf("invalid interpolated curve, throttle must be decreasing at steering %v: %v > %v", s, v, lastValue)
+		}
+		lastValue = v
+	}
+	return nil
 }
 
 func (tc *Config) ValueOf(s types.Steering) types.Throttle {
@@ -169,6 +361,16 @@ func (tc *Config) ValueOf(s types.Steering) types.Throttle {
 	if st < tc.SteeringValues[0] {
 		return tc.ThrottleSteps[0]
 	}
+	if st >= tc.SteeringValues[len(tc.SteeringValues)-1] {
+		return tc.ThrottleSteps[len(tc.ThrottleSteps)-1]
+	}
+
+	switch tc.Interpolation {
+	case InterpolationLinear:
+		return tc.linearValueOf(st)
+	case InterpolationPCHIP:
+		return tc.pchipValueOf(st)
+	}
 
 	for i, steeringStep := range tc.SteeringValues {
 		if st < steeringStep {
@@ -177,3 +379,78 @@ func (tc *Config) ValueOf(s types.Steering) types.Throttle {
 	}
 	return tc.ThrottleSteps[len(tc.ThrottleSteps)-1]
 }
+
+// segment returns index i such as SteeringValues[i] <= st < SteeringValues[i+1]
+func (tc *Config) segment(st types.Steering) int {
+	for i := 1; i < len(tc.SteeringValues); i++ {
+		if st < tc.SteeringValues[i] {
+			return i - 1
+		}
+	}
+	return len(tc.SteeringValues) - 2
+}
+
+func (tc *Config) linearValueOf(st types.Steering) types.Throttle {
+	i := tc.segment(st)
+	x0, x1 := float64(tc.SteeringValues[i]), float64(tc.SteeringValues[i+1])
+	y0, y1 := float64(tc.ThrottleSteps[i]), float64(tc.ThrottleSteps[i+1])
+	return types.Throttle(y0 + (y1-y0)*(float64(st)-x0)/(x1-x0))
+}
+
+func (tc *Config) pchipValueOf(st types.Steering) types.Throttle {
+	i := tc.segment(st)
+	slopes := tc.pchipSlopes()
+	x0, x1 := float64(tc.SteeringValues[i]), float64(tc.SteeringValues[i+1])
+	y0, y1 := float64(tc.ThrottleSteps[i]), float64(tc.ThrottleSteps[i+1])
+	h := x1 - x0
+	t := (float64(st) - x0) / h
+
+	h00 := 2*t*t*t - 3*t*t + 1
+	h10 := t*t*t - 2*t*t + t
+	h01 := -2*t*t*t + 3*t*t
+	h11 := t*t*t - t*t
+	return types.Throttle(h00*y0 + h10*h*slopes[i] + h01*y1 + h11*h*slopes[i+1])
+}
+
+// pchipSlopes computes tangents at each point with Fritsch-Carlson method to preserve monotonicity
+func (tc *Config) pchipSlopes() []float64 {
+	n := len(tc.SteeringValues)
+	slopes := make([]float64, n)
+	if n < 2 {
+		return slopes
+	}
+	h := make([]float64, n-1)
+	delta := make([]float64, n-1)
+	for k := 0; k < n-1; k++ {
+		h[k] = float64(tc.SteeringValues[k+1] - tc.SteeringValues[k])
+		delta[k] = float64(tc.ThrottleSteps[k+1]-tc.ThrottleSteps[k]) / h[k]
+	}
+	if n == 2 {
+		slopes[0], slopes[1] = delta[0], delta[0]
+		return slopes
+	}
+
+	for k := 1; k < n-1; k++ {
+		if delta[k-1]*delta[k] <= 0 {
+			slopes[k] = 0
+			continue
+		}
+		w1 := 2*h[k] + h[k-1]
+		w2 := h[k] + 2*h[k-1]
+		slopes[k] = (w1 + w2) / (w1/delta[k-1] + w2/delta[k])
+	}
+	slopes[0] = pchipEndSlope(h[0], h[1], delta[0], delta[1])
+	slopes[n-1] = pchipEndSlope(h[n-2], h[n-3], delta[n-2], delta[n-3])
+	return slopes
+}
+
+func pchipEndSlope(h0, h1, delta0, delta1 float64) float64 {
+	d := ((2*h0+h1)*delta0 - h0*delta1) / (h0 + h1)
+	if math.Signbit(d) != math.Signbit(delta0) {
+		return 0
+	}
+	if math.Signbit(delta0) != math.Signbit(delta1) && math.Abs(d) > math.Abs(3*delta0) {
+		return 3 * delta0
+	}
+	return d
+}
@@ -7,6 +7,7 @@ import (
 	"path"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestSteeringProcessor_Process(t *testing.T) {
@@ -207,13 +208,8 @@ func TestSpeedZoneProcessor_Process(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			sp := &SpeedZoneProcessor{
-				slowThrottle:     tt.fields.slowThrottle,
-				normalThrottle:   tt.fields.normalThrottle,
-				fastThrottle:     tt.fields.fastThrottle,
-				moderateSteering: 0.4,
-				fullSteering:     0.8,
-			}
+			sp := NewSpeedZoneProcessor(tt.fields.slowThrottle, tt.fields.normalThrottle, tt.fields.fastThrottle,
+				0.4, 0.8)
 			sp.SetSpeedZone(tt.fields.speedZone)
 			if got := sp.Process(tt.args.steering); got != tt.want {
 				t.Errorf("Process() = %v, want %v", got, tt.want)
@@ -222,6 +218,255 @@ func TestSpeedZoneProcessor_Process(t *testing.T) {
 	}
 }
 
+func TestSpeedZoneProcessor_ProcessThresholds(t *testing.T) {
+	tests := []struct {
+		name      string
+		speedZone events.SpeedZone
+		steering  types.Steering
+		want      types.Throttle
+	}{
+		{name: "fast zone, moderate steering", speedZone: events.SpeedZone_FAST, steering: 0.4, want: 0.5},
+		{name: "fast zone, full steering", speedZone: events.SpeedZone_FAST, steering: 0.8, want: 0.2},
+		{name: "normal zone, full steering", speedZone: events.SpeedZone_NORMAL, steering: 0.8, want: 0.5},
+		{name: "normal zone, just over full steering", speedZone: events.SpeedZone_NORMAL, steering: 0.80001, want: 0.2},
+		{name: "unknown zone", speedZone: events.SpeedZone_UNKNOWN, steering: 0., want: 0.2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := NewSpeedZoneProcessor(0.2, 0.5, 0.8, 0.4, 0.8)
+			sp.SetSpeedZone(tt.speedZone)
+			if got := sp.Process(tt.steering); got != tt.want {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedZoneProcessor_ProcessWithConfig(t *testing.T) {
+	cfg := SpeedZoneConfig{
+		Unknown: &Config{SteeringValues: []types.Steering{0.}, ThrottleSteps: []types.Throttle{0.1}},
+		Slow:    &Config{SteeringValues: []types.Steering{0., 0.5}, ThrottleSteps: []types.Throttle{0.3, 0.2}},
+		Normal: &Config{SteeringValues: []types.Steering{0., 1.}, ThrottleSteps: []types.Throttle{0.5, 0.3},
+			Interpolation: InterpolationLinear},
+		Fast: &Config{SteeringValues: []types.Steering{0., 0.3, 0.6}, ThrottleSteps: []types.Throttle{0.9, 0.6, 0.3}},
+	}
+	tests := []struct {
+		name      string
+		speedZone events.SpeedZone
+		steering  types.Steering
+		want      types.Throttle
+	}{
+		{name: "unknown zone", speedZone: events.SpeedZone_UNKNOWN, steering: 0., want: 0.1},
+		{name: "slow zone, straight", speedZone: events.SpeedZone_SLOW, steering: 0., want: 0.3},
+		{name: "slow zone, turn", speedZone: events.SpeedZone_SLOW, steering: -0.6, want: 0.2},
+		{name: "normal zone, interpolated", speedZone: events.SpeedZone_NORMAL, steering: 0.5, want: 0.4},
+		{name: "fast zone, moderate turn", speedZone: events.SpeedZone_FAST, steering: 0.4, want: 0.6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := NewSpeedZoneProcessorWithConfig(&cfg)
+			sp.SetSpeedZone(tt.speedZone)
+			if got := sp.Process(tt.steering); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpeedZoneProcessor_SetSpeedZoneDebounce(t *testing.T) {
+	type message struct {
+		zone    events.SpeedZone
+		elapsed time.Duration
+		want    events.SpeedZone
+	}
+	tests := []struct {
+		name      string
+		upgrade   ZoneDebounce
+		downgrade ZoneDebounce
+		messages  []message
+	}{
+		{
+			name: "no debounce",
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_FAST},
+				{zone: events.SpeedZone_SLOW, want: events.SpeedZone_SLOW},
+			},
+		},
+		{
+			name:    "upgrade after consistent messages",
+			upgrade: ZoneDebounce{Messages: 3},
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_FAST},
+			},
+		},
+		{
+			name:    "flickering zone is ignored",
+			upgrade: ZoneDebounce{Messages: 3},
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_NORMAL, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_UNKNOWN, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_FAST},
+			},
+		},
+		{
+			name:      "upgrade slower than downgrade",
+			upgrade:   ZoneDebounce{Messages: 3},
+			downgrade: ZoneDebounce{Messages: 1},
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_FAST},
+				{zone: events.SpeedZone_SLOW, want: events.SpeedZone_SLOW},
+			},
+		},
+		{
+			name:    "upgrade after dwell time",
+			upgrade: ZoneDebounce{Dwell: 500 * time.Millisecond},
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, elapsed: 300 * time.Millisecond, want: events.SpeedZone_UNKNOWN},
+				{zone: events.SpeedZone_FAST, elapsed: 300 * time.Millisecond, want: events.SpeedZone_FAST},
+			},
+		},
+		{
+			name:      "dwell is reset on zone change",
+			downgrade: ZoneDebounce{Dwell: 500 * time.Millisecond},
+			messages: []message{
+				{zone: events.SpeedZone_NORMAL, want: events.SpeedZone_NORMAL},
+				{zone: events.SpeedZone_SLOW, want: events.SpeedZone_NORMAL},
+				{zone: events.SpeedZone_UNKNOWN, elapsed: 300 * time.Millisecond, want: events.SpeedZone_NORMAL},
+				{zone: events.SpeedZone_SLOW, elapsed: 300 * time.Millisecond, want: events.SpeedZone_NORMAL},
+				{zone: events.SpeedZone_SLOW, elapsed: 300 * time.Millisecond, want: events.SpeedZone_NORMAL},
+				{zone: events.SpeedZone_SLOW, elapsed: 300 * time.Millisecond, want: events.SpeedZone_SLOW},
+			},
+		},
+		{
+			name:      "messages or dwell time",
+			downgrade: ZoneDebounce{Messages: 3, Dwell: 500 * time.Millisecond},
+			messages: []message{
+				{zone: events.SpeedZone_FAST, want: events.SpeedZone_FAST},
+				{zone: events.SpeedZone_SLOW, want: events.SpeedZone_FAST},
+				{zone: events.SpeedZone_SLOW, elapsed: 600 * time.Millisecond, want: events.SpeedZone_SLOW},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			sp := NewSpeedZoneProcessor(0.2, 0.5, 0.8, 0.4, 0.8, WithSpeedZoneDebounce(tt.upgrade, tt.downgrade))
+			sp.clock = func() time.Time { return now }
+
+			for idx, m := range tt.messages {
+				now = now.Add(m.elapsed)
+				sp.SetSpeedZone(m.zone)
+				if got := sp.SpeedZone(); got != m.want {
+					t.Errorf("message %d: SpeedZone() = %v, want %v", idx, got, m.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSpeedZoneProcessor_ProcessRamp(t *testing.T) {
+	now := time.Now()
+	sp := NewSpeedZoneProcessor(0.2, 0.5, 0.8, 0.4, 0.8, WithSpeedZoneRamp(1.))
+	sp.clock = func() time.Time { return now }
+
+	steps := []struct {
+		zone *events.SpeedZone
+		want types.Throttle
+	}{
+		{want: 0.2},
+		{zone: func() *events.SpeedZone { z := events.SpeedZone_FAST; return &z }(), want: 0.3},
+		{want: 0.4},
+		{want: 0.5},
+		{want: 0.6},
+		{want: 0.7},
+		{want: 0.8},
+		{want: 0.8},
+		{zone: func() *events.SpeedZone { z := events.SpeedZone_NORMAL; return &z }(), want: 0.7},
+		{want: 0.6},
+		{want: 0.5},
+		{want: 0.5},
+	}
+	for idx, s := range steps {
+		if s.zone != nil {
+			sp.SetSpeedZone(*s.zone)
+		}
+		if got := sp.Process(0.); !almostEqual(got, s.want) {
+			t.Errorf("step %d: Process() = %v, want %v", idx, got, s.want)
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+
+	// Steering changes inside a zone are not ramped
+	if got := sp.Process(1.); got != 0.2 {
+		t.Errorf("Process() = %v, want %v", got, 0.2)
+	}
+}
+
+func TestNewSpeedZoneConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name: "default",
+			configContent: `{
+	"unknown": {"steering_values": [0.0], "throttle_steps": [0.1]},
+	"slow": {"steering_values": [0.0, 0.5], "throttle_steps": [0.3, 0.2]},
+	"normal": {"steering_values": [0.0, 1.0], "throttle_steps": [0.5, 0.3], "interpolation": "linear"},
+	"fast": {"steering_values": [0.0, 0.3, 0.6], "throttle_steps": [0.9, 0.6, 0.3]}
+}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "unknown" }`,
+			wantErr:       true,
+		},
+		{
+			name: "missing zone",
+			configContent: `{
+	"slow": {"steering_values": [0.0, 0.5], "throttle_steps": [0.3, 0.2]},
+	"normal": {"steering_values": [0.0, 1.0], "throttle_steps": [0.5, 0.3]},
+	"fast": {"steering_values": [0.0, 0.3, 0.6], "throttle_steps": [0.9, 0.6, 0.3]}
+}`,
+			wantErr: true,
+		},
+		{
+			name: "invalid zone",
+			configContent: `{
+	"unknown": {"steering_values": [0.0], "throttle_steps": [0.1]},
+	"slow": {"steering_values": [0.0, 0.5], "throttle_steps": [0.2, 0.3]},
+	"normal": {"steering_values": [0.0, 1.0], "throttle_steps": [0.5, 0.3]},
+	"fast": {"steering_values": [0.0, 0.3, 0.6], "throttle_steps": [0.9, 0.6, 0.3]}
+}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewSpeedZoneConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewSpeedZoneConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestConfig_ValueOf(t *testing.T) {
 	type fields struct {
 		SteeringValue []types.Steering
@@ -316,6 +561,106 @@ func TestConfig_ValueOf(t *testing.T) {
 	}
 }
 
+func TestConfig_ValueOf_Interpolation(t *testing.T) {
+	type fields struct {
+		SteeringValue []types.Steering
+		Data          []types.Throttle
+		Interpolation Interpolation
+	}
+	type args struct {
+		s types.Steering
+	}
+	tests := []struct {
+		name   string
+		fields fields
+		args   args
+		want   types.Throttle
+	}{
+		{
+			name:   "step, between points",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationStep},
+			args:   args{0.25},
+			want:   0.9,
+		},
+		{
+			name:   "linear, on point",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationLinear},
+			args:   args{0.5},
+			want:   0.6,
+		},
+		{
+			name:   "linear, between points",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationLinear},
+			args:   args{0.25},
+			want:   0.75,
+		},
+		{
+			name:   "linear, negative steering",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationLinear},
+			args:   args{-0.75},
+			want:   0.35,
+		},
+		{
+			name:   "linear, steering < min config",
+			fields: fields{[]types.Steering{0.2, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.3}, InterpolationLinear},
+			args:   args{0.1},
+			want:   0.9,
+		},
+		{
+			name:   "linear, over steering",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationLinear},
+			args:   args{1.1},
+			want:   0.1,
+		},
+		{
+			name:   "pchip, on point",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationPCHIP},
+			args:   args{0.5},
+			want:   0.6,
+		},
+		{
+			name:   "pchip, two points is linear",
+			fields: fields{[]types.Steering{0.0, 1.0}, []types.Throttle{0.9, 0.1}, InterpolationPCHIP},
+			args:   args{0.5},
+			want:   0.5,
+		},
+		{
+			name:   "pchip, between points",
+			fields: fields{[]types.Steering{0.0, 0.5, 1.0}, []types.Throttle{0.9, 0.6, 0.1}, InterpolationPCHIP},
+			args:   args{0.25},
+			want:   0.771875,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tc := &Config{
+				SteeringValues: tt.fields.SteeringValue,
+				ThrottleSteps:  tt.fields.Data,
+				Interpolation:  tt.fields.Interpolation,
+			}
+			if got := tc.ValueOf(tt.args.s); !almostEqual(got, tt.want) {
+				t.Errorf("ValueOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ValueOf_PCHIPMonotone(t *testing.T) {
+	tc := &Config{
+		SteeringValues: []types.Steering{0.0, 0.1, 0.15, 0.8, 1.0},
+		ThrottleSteps:  []types.Throttle{0.9, 0.89, 0.5, 0.45, 0.1},
+		Interpolation:  InterpolationPCHIP,
+	}
+	last := tc.ValueOf(0.)
+	for i := 1; i <= 1000; i++ {
+		v := tc.ValueOf(types.Steering(float64(i) / 1000.))
+		if v > last {
+			t.Errorf("curve must be decreasing at %v: %v > %v", float64(i)/1000., v, last)
+		}
+		last = v
+	}
+}
+
 func TestNewConfigFromJson(t *testing.T) {
 	type args struct {
 		configContent string
@@ -377,6 +722,50 @@ func TestNewConfigFromJson(t *testing.T) {
 				configContent: `{
 	"steering_values": [0.0, 0.6, 0.5],
 	"throttle_steps": [0.9, 0.5, 0.1]
+}`,
+			},
+			want:    &emptyConfig,
+			wantErr: true,
+		},
+		{
+			name: "linear interpolation",
+			args: args{
+				configContent: `{
+	"steering_values": [0.0, 0.5, 1.0],
+	"throttle_steps": [0.9, 0.6, 0.1],
+	"interpolation": "linear"
+}
+`,
+			},
+			want: &Config{
+				SteeringValues: []types.Steering{0., 0.5, 1.},
+				ThrottleSteps:  []types.Throttle{0.9, 0.6, 0.1},
+				Interpolation:  InterpolationLinear,
+			},
+		},
+		{
+			name: "pchip interpolation",
+			args: args{
+				configContent: `{
+	"steering_values": [0.0, 0.5, 1.0],
+	"throttle_steps": [0.9, 0.6, 0.1],
+	"interpolation": "pchip"
+}
+`,
+			},
+			want: &Config{
+				SteeringValues: []types.Steering{0., 0.5, 1.},
+				ThrottleSteps:  []types.Throttle{0.9, 0.6, 0.1},
+				Interpolation:  InterpolationPCHIP,
+			},
+		},
+		{
+			name: "unknown interpolation",
+			args: args{
+				configContent: `{
+	"steering_values": [0.0, 0.5, 1.0],
+	"throttle_steps": [0.9, 0.6, 0.1],
+	"interpolation": "spline"
 }`,
 			},
 			want:    &emptyConfig,
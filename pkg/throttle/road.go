@@ -0,0 +1,164 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultRoadTimeout = 1 * time.Second
+
+// RoadProcessor is implemented by processors that use road geometry detected on camera frames
+type RoadProcessor interface {
+	SetRoad(road *events.RoadMessage)
+}
+
+func NewRoadConfigFromJson(fileName string) (*RoadConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg RoadConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.ImageHeight <= 0 {
+		return nil, fmt.Errorf("invalid image height, value must be > 0: %v", cfg.ImageHeight)
+	}
+	if cfg.MinConfidence < 0. || cfg.MinConfidence > 1. {
+		return nil, fmt.Errorf("invalid min confidence: 0.0 <= %v <= 1.0", cfg.MinConfidence)
+	}
+	if cfg.VisibilityGain < 0. {
+		return nil, fmt.Errorf("invalid visibility gain, value must be positive: %v", cfg.VisibilityGain)
+	}
+	if cfg.RoadTimeoutMs < 0 {
+		return nil, fmt.Errorf("invalid road timeout, value must be >= 0: %v", cfg.RoadTimeoutMs)
+	}
+	if err := cfg.ThrottleCurve.validate(); err != nil {
+		return nil, fmt.Errorf("invalid throttle curve: %w", err)
+	}
+	return &cfg, nil
+}
+
+type RoadConfig struct {
+	// ImageHeight is the height in pixels of frames used to detect road
+	ImageHeight int `json:"image_height"`
+	// MinConfidence is the ellipse confidence under which road is ignored
+	MinConfidence float32 `json:"min_confidence"`
+	// VisibilityGain weights the lack of visible road in the difficulty estimation
+	VisibilityGain float64 `json:"visibility_gain"`
+	// ThrottleCurve maps road difficulty (0: long straight road, 1: short or sharp curve) to throttle
+	ThrottleCurve Config `json:"throttle_curve"`
+	// RoadTimeoutMs, older road is ignored and fallback processor is used, default to 1s
+	RoadTimeoutMs int `json:"road_timeout_ms,omitempty"`
+}
+
+func (c *RoadConfig) roadTimeout() time.Duration {
+	if c.RoadTimeoutMs <= 0 {
+		return defaultRoadTimeout
+	}
+	return time.Duration(c.RoadTimeoutMs) * time.Millisecond
+}
+
+// NewRoadGeometryProcessor build a processor that estimates throttle from road shape. When road is unknown or
+// detection isn't confident enough or is too old, throttle is computed by fallback processor.
+func NewRoadGeometryProcessor(fallback Processor, cfg *RoadConfig) *RoadGeometryProcessor {
+	return &RoadGeometryProcessor{
+		fallback: fallback,
+		cfg:      cfg,
+		clock:    time.Now,
+	}
+}
+
+type RoadGeometryProcessor struct {
+	fallback Processor
+	cfg      *RoadConfig
+	clock    func() time.Time
+
+	muRoad       sync.RWMutex
+	road         *events.RoadMessage
+	roadReceived time.Time
+}
+
+func (r *RoadGeometryProcessor) SetRoad(road *events.RoadMessage) {
+	r.muRoad.Lock()
+	defer r.muRoad.Unlock()
+	r.road = road
+	r.roadReceived = r.clock()
+}
+
+// Road returns last road message or nil if it is older than road timeout
+func (r *RoadGeometryProcessor) Road() *events.RoadMessage {
+	r.muRoad.RLock()
+	defer r.muRoad.RUnlock()
+	if r.road == nil || r.clock().Sub(r.roadReceived) > r.cfg.roadTimeout() {
+		return nil
+	}
+	return r.road
+}
+
+func (r *RoadGeometryProcessor) SetSpeedZone(sz events.SpeedZone) {
+	r.fallback.SetSpeedZone(sz)
+}
+
+func (r *RoadGeometryProcessor) SetRealThrottle(t types.Throttle) {
+	if fp, ok := r.fallback.(FeedbackProcessor); ok {
+		fp.SetRealThrottle(t)
+	}
+}
+
+func (r *RoadGeometryProcessor) SetDriveMode(dm events.DriveMode) {
+	if dp, ok := r.fallback.(DriveModeProcessor); ok {
+		dp.SetDriveMode(dm)
+	}
+}
+
+// Process compute throttle from road geometry, steering value is only used by fallback processor
+func (r *RoadGeometryProcessor) Process(steering types.Steering) types.Throttle {
+	road := r.Road()
+	if road == nil || road.GetEllipse() == nil || road.GetEllipse().GetConfidence() < r.cfg.MinConfidence {
+		return r.fallback.Process(steering)
+	}
+
+	curvature := roadCurvature(road.GetEllipse())
+	visibleLength := roadVisibleLength(road, r.cfg.ImageHeight)
+	difficulty := math.Min(1., curvature+r.cfg.VisibilityGain*(1.-visibleLength))
+	zap.S().Debugf("road curvature: %.2f, visible length: %.2f, difficulty: %.2f", curvature, visibleLength, difficulty)
+
+	return r.cfg.ThrottleCurve.ValueOf(types.Steering(difficulty))
+}
+
+// roadCurvature estimates upcoming curvature from ellipse orientation: 0 when road major axis is vertical
+// (straight ahead), 1 when it is horizontal
+func roadCurvature(ellipse *events.Ellipse) float64 {
+	angle := float64(ellipse.GetAngle())
+	if ellipse.GetWidth() > ellipse.GetHeight() {
+		// Major axis is along width
+		angle += 90.
+	}
+	return math.Abs(math.Sin(angle * math.Pi / 180.))
+}
+
+// roadVisibleLength returns ratio of frame height covered by road, from the bottom of the frame to the farthest
+// point of the contour
+func roadVisibleLength(road *events.RoadMessage, imageHeight int) float64 {
+	top := imageHeight
+	if len(road.GetContour()) > 0 {
+		for _, pt := range road.GetContour() {
+			if int(pt.GetY()) < top {
+				top = int(pt.GetY())
+			}
+		}
+	} else if e := road.GetEllipse(); e != nil && e.GetCenter() != nil {
+		top = int(e.GetCenter().GetY()) - int(math.Max(float64(e.GetWidth()), float64(e.GetHeight())))/2
+	}
+	visible := float64(imageHeight-top) / float64(imageHeight)
+	return math.Max(0., math.Min(1., visible))
+}
@@ -0,0 +1,200 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+var testRoadConfig = RoadConfig{
+	ImageHeight:    120,
+	MinConfidence:  0.5,
+	VisibilityGain: 0.5,
+	ThrottleCurve: Config{
+		SteeringValues: []types.Steering{0., 1.},
+		ThrottleSteps:  []types.Throttle{0.8, 0.2},
+		Interpolation:  InterpolationLinear,
+	},
+}
+
+func TestRoadGeometryProcessor_Process(t *testing.T) {
+	type args struct {
+		road     *events.RoadMessage
+		steering types.Steering
+	}
+	tests := []struct {
+		name string
+		args args
+		want types.Throttle
+	}{
+		{
+			name: "no road, use fallback",
+			args: args{road: nil, steering: 0.5},
+			want: 0.3,
+		},
+		{
+			name: "road without ellipse, use fallback",
+			args: args{road: &events.RoadMessage{}, steering: 0.5},
+			want: 0.3,
+		},
+		{
+			name: "low confidence, use fallback",
+			args: args{
+				road: &events.RoadMessage{
+					Contour: []*events.Point{{X: 20, Y: 120}, {X: 60, Y: 0}, {X: 100, Y: 120}},
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 60}, Width: 40, Height: 120, Angle: 0., Confidence: 0.2},
+				},
+				steering: 0.5,
+			},
+			want: 0.3,
+		},
+		{
+			name: "long straight road",
+			args: args{
+				road: &events.RoadMessage{
+					Contour: []*events.Point{{X: 20, Y: 120}, {X: 60, Y: 0}, {X: 100, Y: 120}},
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 60}, Width: 40, Height: 120, Angle: 0., Confidence: 0.9},
+				},
+				steering: 0.5,
+			},
+			want: 0.8,
+		},
+		{
+			name: "short straight road",
+			args: args{
+				road: &events.RoadMessage{
+					Contour: []*events.Point{{X: 20, Y: 120}, {X: 60, Y: 60}, {X: 100, Y: 120}},
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 90}, Width: 40, Height: 60, Angle: 0., Confidence: 0.9},
+				},
+				steering: 0.,
+			},
+			want: 0.65,
+		},
+		{
+			name: "sharp curve",
+			args: args{
+				road: &events.RoadMessage{
+					Contour: []*events.Point{{X: 0, Y: 120}, {X: 60, Y: 0}, {X: 100, Y: 120}},
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 60}, Width: 40, Height: 120, Angle: 90., Confidence: 0.9},
+				},
+				steering: 0.,
+			},
+			want: 0.2,
+		},
+		{
+			name: "ellipse with horizontal major axis",
+			args: args{
+				road: &events.RoadMessage{
+					Contour: []*events.Point{{X: 0, Y: 120}, {X: 60, Y: 0}, {X: 100, Y: 120}},
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 60}, Width: 120, Height: 40, Angle: 0., Confidence: 0.9},
+				},
+				steering: 0.,
+			},
+			want: 0.2,
+		},
+		{
+			name: "no contour, visible length from ellipse",
+			args: args{
+				road: &events.RoadMessage{
+					Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 90}, Width: 40, Height: 60, Angle: 0., Confidence: 0.9},
+				},
+				steering: 0.,
+			},
+			want: 0.65,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRoadGeometryProcessor(NewSteeringProcessor(0.1, 0.5), &testRoadConfig)
+			r.SetRoad(tt.args.road)
+			if got := r.Process(tt.args.steering); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoadGeometryProcessor_RoadTimeout(t *testing.T) {
+	now := time.Now()
+	r := NewRoadGeometryProcessor(NewSteeringProcessor(0.1, 0.5), &testRoadConfig)
+	r.clock = func() time.Time { return now }
+
+	r.SetRoad(&events.RoadMessage{
+		Ellipse: &events.Ellipse{Center: &events.Point{X: 60, Y: 90}, Width: 40, Height: 60, Angle: 0., Confidence: 0.9},
+	})
+	now = now.Add(500 * time.Millisecond)
+	if got := r.Process(0.); !almostEqual(got, 0.65) {
+		t.Errorf("Process() = %v, want %v", got, 0.65)
+	}
+	now = now.Add(time.Second)
+	if got := r.Process(0.); !almostEqual(got, 0.5) {
+		t.Errorf("stale road should be ignored, Process() = %v, want fallback %v", got, 0.5)
+	}
+}
+
+func TestNewRoadConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name: "default",
+			configContent: `{
+	"image_height": 120,
+	"min_confidence": 0.5,
+	"visibility_gain": 0.5,
+	"throttle_curve": {
+		"steering_values": [0.0, 1.0],
+		"throttle_steps": [0.8, 0.2],
+		"interpolation": "linear"
+	}
+}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "image_height" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "missing image height",
+			configContent: `{"min_confidence": 0.5, "throttle_curve": {"steering_values": [0.0], "throttle_steps": [0.5]}}`,
+			wantErr:       true,
+		},
+		{
+			name:          "bad confidence",
+			configContent: `{"image_height": 120, "min_confidence": 1.5, "throttle_curve": {"steering_values": [0.0], "throttle_steps": [0.5]}}`,
+			wantErr:       true,
+		},
+		{
+			name:          "negative road timeout",
+			configContent: `{"image_height": 120, "min_confidence": 0.5, "road_timeout_ms": -1, "throttle_curve": {"steering_values": [0.0], "throttle_steps": [0.5]}}`,
+			wantErr:       true,
+		},
+		{
+			name:          "invalid throttle curve",
+			configContent: `{"image_height": 120, "min_confidence": 0.5, "throttle_curve": {"steering_values": [0.0, 1.0], "throttle_steps": [0.2, 0.8]}}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			got, err := NewRoadConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewRoadConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.ImageHeight != 120 {
+				t.Errorf("NewRoadConfigFromJson() bad image height: %v", got.ImageHeight)
+			}
+		})
+	}
+}
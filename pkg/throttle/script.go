@@ -0,0 +1,228 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+	"go.uber.org/zap"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const scriptFunction = "process"
+
+// DriveModeProcessor is implemented by processors that need current drive mode
+type DriveModeProcessor interface {
+	SetDriveMode(dm events.DriveMode)
+}
+
+func NewScriptConfigFromJson(fileName string) (*ScriptConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg ScriptConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	if cfg.Script == "" {
+		return nil, fmt.Errorf("no script defined")
+	}
+	if cfg.SafeThrottle < -1. || cfg.SafeThrottle > 1. {
+		return nil, fmt.Errorf("invalid safe throttle, value must be between -1 and 1: %v", cfg.SafeThrottle)
+	}
+	if cfg.TimeoutMs <= 0 {
+		return nil, fmt.Errorf("invalid timeout, value must be > 0: %v", cfg.TimeoutMs)
+	}
+	return &cfg, nil
+}
+
+type ScriptConfig struct {
+	// Script is the path of starlark file, it must define a 'process(inputs, state)' function that returns throttle
+	Script string `json:"script"`
+	// SafeThrottle is returned when script fails or times out
+	SafeThrottle types.Throttle `json:"safe_throttle"`
+	// TimeoutMs is the max duration of script execution for each tick, and of script top level code on load
+	TimeoutMs int `json:"timeout_ms"`
+}
+
+// NewScriptProcessor loads starlark script that computes throttle. Script is reloaded, and its state reset, each time
+// file is modified. Following inputs are provided as dict to process function:
+//   - steering: last steering value
+//   - speed_zone: name of last speed zone (UNKNOWN, SLOW, NORMAL, FAST)
+//   - drive_mode: name of current drive mode, PILOT or COPILOT as processor only runs on these modes
+//   - real_throttle: last throttle feedback
+//   - elapsed: seconds since processor start
+//   - dt: seconds since previous tick
+//
+// state is a dict kept between ticks.
+func NewScriptProcessor(cfg *ScriptConfig) (*ScriptProcessor, error) {
+	s := ScriptProcessor{
+		cfg:       cfg,
+		clock:     time.Now,
+		speedZone: events.SpeedZone_UNKNOWN,
+		driveMode: events.DriveMode_INVALID,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.start = s.clock()
+	s.lastProcess = s.start
+	return &s, nil
+}
+
+type ScriptProcessor struct {
+	cfg   *ScriptConfig
+	clock func() time.Time
+
+	mu           sync.Mutex
+	speedZone    events.SpeedZone
+	driveMode    events.DriveMode
+	realThrottle types.Throttle
+
+	process     starlark.Callable
+	state       *starlark.Dict
+	modTime     time.Time
+	start       time.Time
+	lastProcess time.Time
+}
+
+// load compiles script and resets its state
+func (s *ScriptProcessor) load() error {
+	process, modTime, err := s.compile()
+	if err != nil {
+		return err
+	}
+	s.process = process
+	s.state = starlark.NewDict(0)
+	s.modTime = modTime
+	return nil
+}
+
+// compile executes script top level code, with timeout, and returns its process function
+func (s *ScriptProcessor) compile() (starlark.Callable, time.Time, error) {
+	info, err := os.Stat(s.cfg.Script)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("unable to stat script %s: %w", s.cfg.Script, err)
+	}
+	thread, stop := s.newTimedThread()
+	defer stop()
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{While: true}, thread, s.cfg.Script, nil, nil)
+	if err != nil {
+		return nil, info.ModTime(), fmt.Errorf("unable to load script %s: %w", s.cfg.Script, err)
+	}
+	process, ok := globals[scriptFunction].(starlark.Callable)
+	if !ok {
+		return nil, info.ModTime(), fmt.Errorf("script %s doesn't define '%s' function", s.cfg.Script, scriptFunction)
+	}
+	return process, info.ModTime(), nil
+}
+
+// reloadIfModified reloads script when file changes, current script is kept if new version is invalid. Script is
+// compiled without holding mu.
+func (s *ScriptProcessor) reloadIfModified() {
+	info, err := os.Stat(s.cfg.Script)
+	if err != nil {
+		zap.S().Errorf("unable to stat script %s: %v", s.cfg.Script, err)
+		return
+	}
+	s.mu.Lock()
+	unchanged := info.ModTime().Equal(s.modTime)
+	s.mu.Unlock()
+	if unchanged {
+		return
+	}
+
+	process, modTime, err := s.compile()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		// Don't retry until next change
+		s.modTime = modTime
+		zap.S().Errorf("unable to reload script, keep previous version: %v", err)
+		return
+	}
+	s.process = process
+	s.state = starlark.NewDict(0)
+	s.modTime = modTime
+	zap.S().Infof("script %s reloaded", s.cfg.Script)
+}
+
+// newTimedThread returns a thread cancelled after timeout, stop must be called once execution is done
+func (s *ScriptProcessor) newTimedThread() (*starlark.Thread, func() bool) {
+	thread := s.newThread()
+	timer := time.AfterFunc(time.Duration(s.cfg.TimeoutMs)*time.Millisecond, func() {
+		thread.Cancel("timeout")
+	})
+	return thread, timer.Stop
+}
+
+func (s *ScriptProcessor) newThread() *starlark.Thread {
+	return &starlark.Thread{
+		Name: "throttle",
+		Print: func(_ *starlark.Thread, msg string) {
+			zap.S().Infof("script: %s", msg)
+		},
+	}
+}
+
+func (s *ScriptProcessor) Process(steering types.Steering) types.Throttle {
+	s.reloadIfModified()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock()
+	inputs := starlark.NewDict(6)
+	for k, v := range map[string]starlark.Value{
+		"steering":      starlark.Float(steering),
+		"speed_zone":    starlark.String(s.speedZone.String()),
+		"drive_mode":    starlark.String(s.driveMode.String()),
+		"real_throttle": starlark.Float(s.realThrottle),
+		"elapsed":       starlark.Float(now.Sub(s.start).Seconds()),
+		"dt":            starlark.Float(now.Sub(s.lastProcess).Seconds()),
+	} {
+		_ = inputs.SetKey(starlark.String(k), v)
+	}
+	s.lastProcess = now
+
+	thread, stop := s.newTimedThread()
+	defer stop()
+
+	result, err := starlark.Call(thread, s.process, starlark.Tuple{inputs, s.state}, nil)
+	if err != nil {
+		zap.S().Errorf("script execution failed, use safe throttle %v: %v", s.cfg.SafeThrottle, err)
+		return s.cfg.SafeThrottle
+	}
+	value, ok := starlark.AsFloat(result)
+	if !ok || math.IsNaN(value) || value < -1. || value > 1. {
+		zap.S().Errorf("invalid throttle '%v' returned by script, use safe throttle %v", result, s.cfg.SafeThrottle)
+		return s.cfg.SafeThrottle
+	}
+	return types.Throttle(value)
+}
+
+func (s *ScriptProcessor) SetSpeedZone(sz events.SpeedZone) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.speedZone = sz
+}
+
+func (s *ScriptProcessor) SetDriveMode(dm events.DriveMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.driveMode = dm
+}
+
+func (s *ScriptProcessor) SetRealThrottle(t types.Throttle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.realThrottle = t
+}
@@ -0,0 +1,331 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-base/testtools"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.starlark.net/starlark"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func writeScript(t *testing.T, fileName, content string, modTime time.Time) {
+	err := os.WriteFile(fileName, []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("unable to write script: %v", err)
+	}
+	// Ensure modification is detected whatever file system time resolution
+	if err := os.Chtimes(fileName, modTime, modTime); err != nil {
+		t.Fatalf("unable to change script time: %v", err)
+	}
+}
+
+func TestScriptProcessor_Process(t *testing.T) {
+	type args struct {
+		steering     types.Steering
+		speedZone    events.SpeedZone
+		driveMode    events.DriveMode
+		realThrottle types.Throttle
+	}
+	tests := []struct {
+		name   string
+		script string
+		args   args
+		want   types.Throttle
+	}{
+		{
+			name: "from steering",
+			script: `
+def process(inputs, state):
+    return 0.5 - abs(inputs["steering"]) * 0.3
+`,
+			args: args{steering: 0.5},
+			want: 0.35,
+		},
+		{
+			name: "from speed zone and drive mode",
+			script: `
+def process(inputs, state):
+    if inputs["drive_mode"] != "PILOT":
+        return 0.
+    if inputs["speed_zone"] == "FAST":
+        return 0.8
+    return 0.3
+`,
+			args: args{speedZone: events.SpeedZone_FAST, driveMode: events.DriveMode_PILOT},
+			want: 0.8,
+		},
+		{
+			name: "from feedback",
+			script: `
+def process(inputs, state):
+    return min(inputs["real_throttle"] + 0.1, 0.5)
+`,
+			args: args{realThrottle: 0.3},
+			want: 0.4,
+		},
+		{
+			name: "int result",
+			script: `
+def process(inputs, state):
+    return 1
+`,
+			want: 1.,
+		},
+		{
+			name: "script error",
+			script: `
+def process(inputs, state):
+    return inputs["unknown"]
+`,
+			want: 0.2,
+		},
+		{
+			name: "invalid result",
+			script: `
+def process(inputs, state):
+    return "fast"
+`,
+			want: 0.2,
+		},
+		{
+			name: "out of range result",
+			script: `
+def process(inputs, state):
+    return 1.5
+`,
+			want: 0.2,
+		},
+		{
+			name: "timeout",
+			script: `
+def process(inputs, state):
+    while True:
+        pass
+`,
+			want: 0.2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := path.Join(t.TempDir(), "script.star")
+			writeScript(t, fileName, tt.script, time.Now())
+			s, err := NewScriptProcessor(&ScriptConfig{Script: fileName, SafeThrottle: 0.2, TimeoutMs: 50})
+			if err != nil {
+				t.Fatalf("unable to load script: %v", err)
+			}
+			s.SetSpeedZone(tt.args.speedZone)
+			s.SetDriveMode(tt.args.driveMode)
+			s.SetRealThrottle(tt.args.realThrottle)
+			if got := s.Process(tt.args.steering); !almostEqual(got, tt.want) {
+				t.Errorf("Process() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScriptProcessor_State(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "script.star")
+	writeScript(t, fileName, `
+def process(inputs, state):
+    state["ticks"] = state.get("ticks", 0) + 1
+    state["elapsed"] = inputs["elapsed"]
+    return min(state["ticks"] * 0.1 + inputs["dt"], 1.)
+`, time.Now())
+
+	now := time.Now()
+	s, err := NewScriptProcessor(&ScriptConfig{Script: fileName, SafeThrottle: 0., TimeoutMs: 50})
+	if err != nil {
+		t.Fatalf("unable to load script: %v", err)
+	}
+	s.clock = func() time.Time { return now }
+	s.start = now
+	s.lastProcess = now
+
+	for i, want := range []types.Throttle{0.1, 0.3, 0.5} {
+		if i > 0 {
+			now = now.Add(time.Duration(i) * 100 * time.Millisecond)
+		}
+		if got := s.Process(0.); !almostEqual(got, want) {
+			t.Errorf("tick %d: Process() = %v, want %v", i, got, want)
+		}
+	}
+	if elapsed, _, _ := s.state.Get(starlark.String("elapsed")); elapsed.String() != "0.3" {
+		t.Errorf("bad elapsed time: %v, want %v", elapsed, 0.3)
+	}
+}
+
+func TestScriptProcessor_Reload(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "script.star")
+	modTime := time.Now().Add(-1 * time.Minute)
+	writeScript(t, fileName, `
+def process(inputs, state):
+    state["ticks"] = state.get("ticks", 0) + 1
+    return 0.1 * state["ticks"]
+`, modTime)
+	s, err := NewScriptProcessor(&ScriptConfig{Script: fileName, SafeThrottle: 0., TimeoutMs: 50})
+	if err != nil {
+		t.Fatalf("unable to load script: %v", err)
+	}
+	s.Process(0.)
+	if got := s.Process(0.); !almostEqual(got, 0.2) {
+		t.Errorf("Process() = %v, want %v", got, 0.2)
+	}
+
+	modTime = modTime.Add(time.Second)
+	writeScript(t, fileName, `
+def process(inputs, state):
+    state["ticks"] = state.get("ticks", 0) + 1
+    return 0.5 + 0.1 * state["ticks"]
+`, modTime)
+	if got := s.Process(0.); !almostEqual(got, 0.6) {
+		t.Errorf("new script should be used with new state: %v, want %v", got, 0.6)
+	}
+
+	modTime = modTime.Add(time.Second)
+	writeScript(t, fileName, `def process(inputs, state) return 0.`, modTime)
+	if got := s.Process(0.); !almostEqual(got, 0.7) {
+		t.Errorf("previous script should be kept on invalid script: %v, want %v", got, 0.7)
+	}
+
+	modTime = modTime.Add(time.Second)
+	writeScript(t, fileName, `
+def forever():
+    while True:
+        pass
+
+forever()
+
+def process(inputs, state):
+    return 0.
+`, modTime)
+	start := time.Now()
+	if got := s.Process(0.); !almostEqual(got, 0.8) {
+		t.Errorf("previous script should be kept when reload times out: %v, want %v", got, 0.8)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("reload should be interrupted after timeout, took %v", d)
+	}
+}
+
+func TestNewScriptProcessor(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		wantErr bool
+	}{
+		{
+			name: "valid script",
+			script: `
+def process(inputs, state):
+    return 0.5
+`,
+		},
+		{
+			name:    "syntax error",
+			script:  `def process(inputs, state) return 0.5`,
+			wantErr: true,
+		},
+		{
+			name:    "no process function",
+			script:  `throttle = 0.5`,
+			wantErr: true,
+		},
+		{
+			name: "top level code times out",
+			script: `
+def forever():
+    while True:
+        pass
+
+forever()
+
+def process(inputs, state):
+    return 0.5
+`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileName := path.Join(t.TempDir(), "script.star")
+			writeScript(t, fileName, tt.script, time.Now())
+			_, err := NewScriptProcessor(&ScriptConfig{Script: fileName, TimeoutMs: 50})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewScriptProcessor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewScriptConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "valid config",
+			configContent: `{"script": "throttle.star", "safe_throttle": 0.1, "timeout_ms": 20}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "script" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "no script",
+			configContent: `{"safe_throttle": 0.1, "timeout_ms": 20}`,
+			wantErr:       true,
+		},
+		{
+			name:          "no timeout",
+			configContent: `{"script": "throttle.star", "safe_throttle": 0.1}`,
+			wantErr:       true,
+		},
+		{
+			name:          "bad safe throttle",
+			configContent: `{"script": "throttle.star", "safe_throttle": 1.1, "timeout_ms": 20}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewScriptConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewScriptConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScriptProcessor_DriveModeFromController(t *testing.T) {
+	fileName := path.Join(t.TempDir(), "script.star")
+	writeScript(t, fileName, `
+def process(inputs, state):
+    state["drive_mode"] = inputs["drive_mode"]
+    return 0.5
+`, time.Now())
+	s, err := NewScriptProcessor(&ScriptConfig{Script: fileName, TimeoutMs: 50})
+	if err != nil {
+		t.Fatalf("unable to load script: %v", err)
+	}
+	c := New(nil, "topic/throttle", "topic/driveMode", "topic/rcThrottle", "topic/steering",
+		"topic/feedback/throttle", "topic/max/throttle", "topic/speedZone", 1., 10,
+		WithThrottleProcessor(s),
+		WithCopilotStrategy(CopilotCap),
+	)
+	c.onDriveMode(nil, testtools.NewFakeMessageFromProtobuf("topic/driveMode", &events.DriveModeMessage{DriveMode: events.DriveMode_COPILOT}))
+	c.onPublishPilotValue()
+
+	if dm, _, _ := s.state.Get(starlark.String("drive_mode")); dm != starlark.String("COPILOT") {
+		t.Errorf("bad drive mode input: %v, want %v", dm, "COPILOT")
+	}
+}
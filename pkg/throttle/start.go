@@ -0,0 +1,209 @@
+package throttle
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"os"
+	"sync"
+	"time"
+)
+
+type LaunchProfile string
+
+const (
+	// LaunchRamp scales processor throttle linearly from neutral to full value over launch duration
+	LaunchRamp LaunchProfile = "ramp"
+	// LaunchTraction increases throttle while throttle feedback follows command
+	LaunchTraction LaunchProfile = "traction"
+)
+
+func NewStartConfigFromJson(fileName string) (*StartConfig, error) {
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read content from %s file: %w", fileName, err)
+	}
+	var cfg StartConfig
+	err = json.Unmarshal(content, &cfg)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unmarshal json content from %s file: %w", fileName, err)
+	}
+	switch cfg.Profile {
+	case LaunchRamp:
+		if cfg.DurationMs <= 0 {
+			return nil, fmt.Errorf("invalid duration, value must be > 0: %v", cfg.DurationMs)
+		}
+	case LaunchTraction:
+		if cfg.RampRate <= 0. {
+			return nil, fmt.Errorf("invalid ramp rate, value must be > 0: %v", cfg.RampRate)
+		}
+		if cfg.MaxSlip <= 0. {
+			return nil, fmt.Errorf("invalid max slip, value must be > 0: %v", cfg.MaxSlip)
+		}
+	default:
+		return nil, fmt.Errorf("invalid launch profile '%v', accepted values: %v, %v", cfg.Profile,
+			LaunchRamp, LaunchTraction)
+	}
+	return &cfg, nil
+}
+
+type StartConfig struct {
+	Profile LaunchProfile `json:"profile"`
+	// DurationMs is the duration of ramp profile
+	DurationMs int `json:"duration_ms,omitempty"`
+	// RampRate is the throttle increase by second of traction profile
+	RampRate float64 `json:"ramp_rate,omitempty"`
+	// MaxSlip is the max difference allowed between command and throttle feedback with traction profile
+	MaxSlip types.Throttle `json:"max_slip,omitempty"`
+}
+
+type StartState int
+
+const (
+	// StartIdle when car isn't in PILOT mode
+	StartIdle StartState = iota
+	// StartWaiting holds neutral until go signal
+	StartWaiting
+	// StartLaunching applies launch profile
+	StartLaunching
+	// StartRunning lets processor drive
+	StartRunning
+)
+
+func (s StartState) String() string {
+	switch s {
+	case StartIdle:
+		return "idle"
+	case StartWaiting:
+		return "waiting"
+	case StartLaunching:
+		return "launching"
+	case StartRunning:
+		return "running"
+	}
+	return "unknown"
+}
+
+// NewStartSequencer build the race start state machine
+func NewStartSequencer(cfg *StartConfig) *StartSequencer {
+	return &StartSequencer{
+		cfg:   cfg,
+		state: StartIdle,
+		clock: time.Now,
+	}
+}
+
+type StartSequencer struct {
+	cfg   *StartConfig
+	clock func() time.Time
+
+	mu           sync.Mutex
+	state        StartState
+	launchStart  time.Time
+	lastUpdate   time.Time
+	command      types.Throttle
+	realThrottle types.Throttle
+}
+
+func (s *StartSequencer) State() StartState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state
+}
+
+func (s *StartSequencer) setState(state StartState) {
+	if state == s.state {
+		return
+	}
+	zap.S().Infof("race start: %v -> %v", s.state, state)
+	s.state = state
+}
+
+// SetDriveMode arms sequencer when PILOT mode is enabled
+func (s *StartSequencer) SetDriveMode(dm events.DriveMode) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if dm != events.DriveMode_PILOT {
+		s.setState(StartIdle)
+		return
+	}
+	if s.state == StartIdle {
+		s.setState(StartWaiting)
+	}
+}
+
+// Go starts launch profile
+func (s *StartSequencer) Go() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.state != StartWaiting {
+		zap.S().Infof("race start: ignore go signal on %v state", s.state)
+		return
+	}
+	now := s.clock()
+	s.launchStart = now
+	s.lastUpdate = now
+	s.command = 0.
+	s.setState(StartLaunching)
+}
+
+func (s *StartSequencer) SetRealThrottle(t types.Throttle) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.realThrottle = t
+}
+
+// Throttle returns throttle to apply regarding start state and throttle computed by processor
+func (s *StartSequencer) Throttle(target types.Throttle) types.Throttle {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.state {
+	case StartWaiting:
+		return 0.
+	case StartLaunching:
+		now := s.clock()
+		var command types.Throttle
+		var done bool
+		if s.cfg.Profile == LaunchTraction {
+			command, done = s.tractionRamp(now, target)
+		} else {
+			command, done = s.timeRamp(now, target)
+		}
+		s.lastUpdate = now
+		s.command = command
+		if done {
+			s.setState(StartRunning)
+		}
+		return command
+	}
+	return target
+}
+
+// timeRamp scales target throttle with elapsed time since go signal, launch is done at the end of configured duration
+func (s *StartSequencer) timeRamp(now time.Time, target types.Throttle) (types.Throttle, bool) {
+	ratio := float64(now.Sub(s.launchStart).Milliseconds()) / float64(s.cfg.DurationMs)
+	if ratio >= 1. {
+		return target, true
+	}
+	return types.Throttle(ratio) * target, false
+}
+
+// tractionRamp increases throttle at configured rate without exceeding throttle feedback more than max slip, launch
+// is done when target throttle is reached
+func (s *StartSequencer) tractionRamp(now time.Time, target types.Throttle) (types.Throttle, bool) {
+	command := s.command + types.Throttle(s.cfg.RampRate*now.Sub(s.lastUpdate).Seconds())
+	if command > s.realThrottle+s.cfg.MaxSlip {
+		// Wheels spin, wait feedback catches up
+		command = s.realThrottle + s.cfg.MaxSlip
+		if command < s.command {
+			command = s.command
+		}
+	}
+	if command >= target {
+		return target, true
+	}
+	return command, false
+}
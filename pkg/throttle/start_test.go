@@ -0,0 +1,167 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestStartSequencer_Throttle(t *testing.T) {
+	type step struct {
+		elapsed      time.Duration
+		realThrottle types.Throttle
+		target       types.Throttle
+		want         types.Throttle
+		wantState    StartState
+	}
+	tests := []struct {
+		name  string
+		cfg   StartConfig
+		goSig bool
+		steps []step
+	}{
+		{
+			name: "wait go signal",
+			cfg:  StartConfig{Profile: LaunchRamp, DurationMs: 1000},
+			steps: []step{
+				{target: 0.8, want: 0., wantState: StartWaiting},
+				{elapsed: 2 * time.Second, target: 0.8, want: 0., wantState: StartWaiting},
+			},
+		},
+		{
+			name:  "time ramp",
+			cfg:   StartConfig{Profile: LaunchRamp, DurationMs: 1000},
+			goSig: true,
+			steps: []step{
+				{target: 0.8, want: 0., wantState: StartLaunching},
+				{elapsed: 500 * time.Millisecond, target: 0.8, want: 0.4, wantState: StartLaunching},
+				{elapsed: 250 * time.Millisecond, target: 0.8, want: 0.6, wantState: StartLaunching},
+				{elapsed: 250 * time.Millisecond, target: 0.8, want: 0.8, wantState: StartRunning},
+				{elapsed: 100 * time.Millisecond, target: 0.5, want: 0.5, wantState: StartRunning},
+			},
+		},
+		{
+			name:  "time ramp follows processor throttle",
+			cfg:   StartConfig{Profile: LaunchRamp, DurationMs: 1000},
+			goSig: true,
+			steps: []step{
+				{elapsed: 500 * time.Millisecond, target: 0.8, want: 0.4, wantState: StartLaunching},
+				{elapsed: 100 * time.Millisecond, target: 0.3, want: 0.18, wantState: StartLaunching},
+				{elapsed: 400 * time.Millisecond, target: 0.3, want: 0.3, wantState: StartRunning},
+			},
+		},
+		{
+			name:  "traction ramp",
+			cfg:   StartConfig{Profile: LaunchTraction, RampRate: 1., MaxSlip: 0.2},
+			goSig: true,
+			steps: []step{
+				{elapsed: 100 * time.Millisecond, target: 0.5, want: 0.1, wantState: StartLaunching},
+				{elapsed: 200 * time.Millisecond, realThrottle: 0., target: 0.5, want: 0.2, wantState: StartLaunching},
+				{elapsed: 200 * time.Millisecond, realThrottle: 0.1, target: 0.5, want: 0.3, wantState: StartLaunching},
+				{elapsed: 300 * time.Millisecond, realThrottle: 0.3, target: 0.5, want: 0.5, wantState: StartRunning},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			s := NewStartSequencer(&tt.cfg)
+			s.clock = func() time.Time { return now }
+
+			s.SetDriveMode(events.DriveMode_PILOT)
+			if tt.goSig {
+				s.Go()
+			}
+			for i, st := range tt.steps {
+				now = now.Add(st.elapsed)
+				s.SetRealThrottle(st.realThrottle)
+				if got := s.Throttle(st.target); !almostEqual(got, st.want) {
+					t.Errorf("step %d: Throttle() = %v, want %v", i, got, st.want)
+				}
+				if s.State() != st.wantState {
+					t.Errorf("step %d: state = %v, want %v", i, s.State(), st.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestStartSequencer_SetDriveMode(t *testing.T) {
+	s := NewStartSequencer(&StartConfig{Profile: LaunchRamp, DurationMs: 1000})
+	if s.State() != StartIdle {
+		t.Errorf("bad initial state: %v, want %v", s.State(), StartIdle)
+	}
+
+	s.Go()
+	if s.State() != StartIdle {
+		t.Errorf("go signal should be ignored before PILOT mode: %v", s.State())
+	}
+	if got := s.Throttle(0.5); got != 0.5 {
+		t.Errorf("throttle should not be changed on idle state: %v", got)
+	}
+
+	s.SetDriveMode(events.DriveMode_PILOT)
+	s.Go()
+	if s.State() != StartLaunching {
+		t.Errorf("bad state after go: %v, want %v", s.State(), StartLaunching)
+	}
+
+	s.SetDriveMode(events.DriveMode_USER)
+	s.SetDriveMode(events.DriveMode_PILOT)
+	if s.State() != StartWaiting {
+		t.Errorf("sequencer should be rearmed on PILOT mode: %v, want %v", s.State(), StartWaiting)
+	}
+}
+
+func TestNewStartConfigFromJson(t *testing.T) {
+	tests := []struct {
+		name          string
+		configContent string
+		wantErr       bool
+	}{
+		{
+			name:          "ramp",
+			configContent: `{"profile": "ramp", "duration_ms": 1000}`,
+		},
+		{
+			name:          "traction",
+			configContent: `{"profile": "traction", "ramp_rate": 0.8, "max_slip": 0.2}`,
+		},
+		{
+			name:          "invalid config",
+			configContent: `{ "profile" }`,
+			wantErr:       true,
+		},
+		{
+			name:          "unknown profile",
+			configContent: `{"profile": "rocket", "duration_ms": 1000}`,
+			wantErr:       true,
+		},
+		{
+			name:          "ramp without duration",
+			configContent: `{"profile": "ramp"}`,
+			wantErr:       true,
+		},
+		{
+			name:          "traction without slip",
+			configContent: `{"profile": "traction", "ramp_rate": 0.8}`,
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configName := path.Join(t.TempDir(), "config.json")
+			err := os.WriteFile(configName, []byte(tt.configContent), 0644)
+			if err != nil {
+				t.Errorf("unable to create test config: %v", err)
+			}
+			_, err = NewStartConfigFromJson(configName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewStartConfigFromJson() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package throttle
+
+import (
+	"encoding/json"
+	"go.uber.org/zap"
+	"time"
+)
+
+// WithStatusTopic publishes safety events, as json StatusEvent, on status topic
+func WithStatusTopic(topic string) Option {
+	return func(c *Controller) {
+		c.statusTopic = topic
+	}
+}
+
+// StatusEvent reports a safety state change of throttle controller
+type StatusEvent struct {
+	// Component is the controller part that raises event
+	Component string `json:"component"`
+	// State is the new component state
+	State string `json:"state"`
+	// Reason explains state change, optional
+	Reason string `json:"reason,omitempty"`
+	// TimestampMs is the event time as unix timestamp in milliseconds
+	TimestampMs int64 `json:"timestamp_ms"`
+}
+
+func (c *Controller) publishStatus(component, state, reason string) {
+	if c.statusTopic == "" {
+		return
+	}
+	event := StatusEvent{
+		Component:   component,
+		State:       state,
+		Reason:      reason,
+		TimestampMs: time.Now().UnixMilli(),
+	}
+	payload, err := json.Marshal(&event)
+	if err != nil {
+		zap.S().Errorf("unable to marshal status event %v: %v", event, err)
+		return
+	}
+	publish(c.client, c.statusTopic, payload)
+}
@@ -0,0 +1,127 @@
+package throttle
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// WithDriveModeTransitions publishes exitThrottle, neutral or brake, when car leaves PILOT mode and stopThrottle as soon
+// as drive mode is INVALID. These values are published during holdDuration, then neutral is published. Non-neutral rc
+// throttle on USER or COPILOT mode gives control back to user before end of hold. On PILOT mode, positive throttle is
+// ramped up from neutral during softStart.
+func WithDriveModeTransitions(exitThrottle, stopThrottle types.Throttle, holdDuration, softStart time.Duration) Option {
+	return func(c *Controller) {
+		c.transitions = &transitions{
+			exitThrottle: exitThrottle,
+			stopThrottle: stopThrottle,
+			holdDuration: holdDuration,
+			softStart:    softStart,
+			clock:        time.Now,
+		}
+	}
+}
+
+type transitions struct {
+	exitThrottle types.Throttle
+	stopThrottle types.Throttle
+	holdDuration time.Duration
+	softStart    time.Duration
+	clock        func() time.Time
+
+	// pilotStart is protected by Controller.muDriveMode
+	pilotStart time.Time
+
+	mu        sync.Mutex
+	holding   bool
+	holdValue types.Throttle
+	holdUntil time.Time
+}
+
+// SoftStart scales positive throttle with elapsed time since PILOT mode is enabled
+func (t *transitions) SoftStart(throttle types.Throttle) types.Throttle {
+	if throttle <= 0. || t.softStart <= 0 {
+		return throttle
+	}
+	elapsed := t.clock().Sub(t.pilotStart)
+	if elapsed >= t.softStart {
+		return throttle
+	}
+	return throttle * types.Throttle(elapsed.Seconds()/t.softStart.Seconds())
+}
+
+// Hold starts publishing value until end of hold duration
+func (t *transitions) Hold(value types.Throttle) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.holding = true
+	t.holdValue = value
+	t.holdUntil = t.clock().Add(t.holdDuration)
+}
+
+// Cancel stops current hold, neutral isn't published
+func (t *transitions) Cancel() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.holding = false
+}
+
+// Holding returns true while a hold is in progress
+func (t *transitions) Holding() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.holding
+}
+
+// Pending returns throttle to publish and true while hold is in progress, neutral is returned once at end of hold
+func (t *transitions) Pending() (types.Throttle, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.holding {
+		return 0., false
+	}
+	if t.clock().Before(t.holdUntil) {
+		return t.holdValue, true
+	}
+	t.holding = false
+	return 0., true
+}
+
+// onDriveModeChange must be called with muDriveMode lock held, nothing is published if emergency stop is latched
+func (c *Controller) onDriveModeChange(previous, current events.DriveMode, eStopLatched bool) {
+	zap.S().Infof("drive mode changed from %v to %v", previous, current)
+	c.publishStatus("drive_mode", current.String(), fmt.Sprintf("from %v", previous))
+
+	if c.transitions == nil {
+		return
+	}
+	switch {
+	case current == events.DriveMode_PILOT:
+		c.transitions.Cancel()
+		c.transitions.pilotStart = c.transitions.clock()
+	case eStopLatched:
+		// Emergency stop throttle is published
+	case current == events.DriveMode_INVALID:
+		zap.S().Warnf("invalid drive mode, publish stop throttle %v", c.transitions.stopThrottle)
+		c.transitions.Hold(c.transitions.stopThrottle)
+		c.publishEmergencyThrottle(c.transitions.stopThrottle, 1.)
+	case previous == events.DriveMode_PILOT:
+		c.transitions.Hold(c.transitions.exitThrottle)
+		c.publishEmergencyThrottle(c.transitions.exitThrottle, 1.)
+	}
+}
+
+// publishTransitionThrottle publishes hold throttle, it returns false if no hold is in progress
+func (c *Controller) publishTransitionThrottle() bool {
+	if c.transitions == nil {
+		return false
+	}
+	throttle, pending := c.transitions.Pending()
+	if pending {
+		c.publishEmergencyThrottle(throttle, 1.)
+	}
+	return pending
+}
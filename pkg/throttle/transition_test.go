@@ -0,0 +1,34 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTransitions_SoftStart(t *testing.T) {
+	tests := []struct {
+		name      string
+		softStart time.Duration
+		elapsed   time.Duration
+		throttle  types.Throttle
+		want      types.Throttle
+	}{
+		{name: "pilot start", softStart: time.Second, throttle: 0.8, want: 0.},
+		{name: "during soft start", softStart: time.Second, elapsed: 250 * time.Millisecond, throttle: 0.8, want: 0.2},
+		{name: "after soft start", softStart: time.Second, elapsed: 2 * time.Second, throttle: 0.8, want: 0.8},
+		{name: "brake during soft start", softStart: time.Second, elapsed: 250 * time.Millisecond, throttle: -0.5, want: -0.5},
+		{name: "soft start disabled", throttle: 0.8, want: 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			tr := transitions{softStart: tt.softStart, clock: func() time.Time { return now }, pilotStart: now}
+			now = now.Add(tt.elapsed)
+			if got := tr.SoftStart(tt.throttle); math.Abs(float64(got-tt.want)) > 0.0001 {
+				t.Errorf("SoftStart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package throttle
+
+import (
+	"fmt"
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+type SteeringTimestamp string
+
+const (
+	// SteeringTimestampReceipt dates steering messages on reception
+	SteeringTimestampReceipt SteeringTimestamp = "receipt"
+	// SteeringTimestampFrame dates steering messages with creation time of their source frame, reception time is
+	// used if frame reference is missing. Clocks of autopilot and throttle hosts must be synchronized.
+	SteeringTimestampFrame SteeringTimestamp = "frame"
+)
+
+func NewSteeringTimestamp(value string) (SteeringTimestamp, error) {
+	switch s := SteeringTimestamp(value); s {
+	case SteeringTimestampReceipt, SteeringTimestampFrame:
+		return s, nil
+	}
+	return "", fmt.Errorf("invalid steering timestamp '%v', accepted values: %v, %v", value,
+		SteeringTimestampReceipt, SteeringTimestampFrame)
+}
+
+type FailsafeMode string
+
+const (
+	// FailsafeNeutral publishes neutral throttle
+	FailsafeNeutral FailsafeMode = "neutral"
+	// FailsafeBrake publishes a negative throttle
+	FailsafeBrake FailsafeMode = "brake"
+	// FailsafeCrawl publishes a small positive throttle
+	FailsafeCrawl FailsafeMode = "crawl"
+)
+
+type Failsafe struct {
+	Mode     FailsafeMode
+	Throttle types.Throttle
+}
+
+// NewFailsafe checks throttle value is consistent with mode, value is ignored for FailsafeNeutral
+func NewFailsafe(mode string, value types.Throttle) (*Failsafe, error) {
+	switch m := FailsafeMode(mode); m {
+	case FailsafeNeutral:
+		return &Failsafe{Mode: m, Throttle: 0.}, nil
+	case FailsafeBrake:
+		if value < -1. || value >= 0. {
+			return nil, fmt.Errorf("invalid brake failsafe throttle, value must be in [-1, 0[: %v", value)
+		}
+		return &Failsafe{Mode: m, Throttle: value}, nil
+	case FailsafeCrawl:
+		if value <= 0. || value > 1. {
+			return nil, fmt.Errorf("invalid crawl failsafe throttle, value must be in ]0, 1]: %v", value)
+		}
+		return &Failsafe{Mode: m, Throttle: value}, nil
+	}
+	return nil, fmt.Errorf("invalid failsafe mode '%v', accepted values: %v, %v, %v", mode,
+		FailsafeNeutral, FailsafeBrake, FailsafeCrawl)
+}
+
+// WithSteeringWatchdog publishes failsafe throttle on PILOT mode when last steering message is older than timeout.
+// Processor throttle is published again as soon as a fresh steering message is received. Failsafe throttle isn't
+// adjusted by brake controller but goes through output controller.
+func WithSteeringWatchdog(timeout time.Duration, timestamp SteeringTimestamp, failsafe *Failsafe) Option {
+	return func(c *Controller) {
+		c.steeringWatchdog = &steeringWatchdog{
+			timeout:   timeout,
+			timestamp: timestamp,
+			failsafe:  failsafe,
+			clock:     time.Now,
+		}
+	}
+}
+
+type steeringWatchdog struct {
+	timeout   time.Duration
+	timestamp SteeringTimestamp
+	failsafe  *Failsafe
+	clock     func() time.Time
+
+	mu           sync.Mutex
+	lastSteering time.Time
+	expired      bool
+}
+
+func (w *steeringWatchdog) Feed(msg *events.SteeringMessage) {
+	t := w.clock()
+	if w.timestamp == SteeringTimestampFrame && msg.GetFrameRef().GetCreatedAt() != nil {
+		// Frame can't be created after reception, clock skew could otherwise delay expiration
+		if frameTime := msg.GetFrameRef().GetCreatedAt().AsTime(); frameTime.Before(t) {
+			t = frameTime
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t.After(w.lastSteering) {
+		w.lastSteering = t
+	}
+}
+
+// Expired returns true if no fresh steering is available, changed is true on first call after state change
+func (w *steeringWatchdog) Expired() (expired bool, changed bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	expired = w.lastSteering.IsZero() || w.clock().Sub(w.lastSteering) > w.timeout
+	changed = expired != w.expired
+	if changed {
+		if expired {
+			zap.S().Warnf("watchdog: no steering since %v, publish %v failsafe throttle", w.timeout, w.failsafe.Mode)
+		} else {
+			zap.S().Infof("watchdog: fresh steering received, resume autopilot throttle")
+		}
+	}
+	w.expired = expired
+	return expired, changed
+}
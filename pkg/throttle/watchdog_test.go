@@ -0,0 +1,84 @@
+package throttle
+
+import (
+	"github.com/cyrilix/robocar-protobuf/go/events"
+	"github.com/cyrilix/robocar-throttle/pkg/types"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"testing"
+	"time"
+)
+
+func TestSteeringWatchdog_Expired(t *testing.T) {
+	tests := []struct {
+		name      string
+		timestamp SteeringTimestamp
+		noSignal  bool
+		frameAge  *time.Duration
+		elapsed   time.Duration
+		want      bool
+	}{
+		{name: "no steering", timestamp: SteeringTimestampReceipt, noSignal: true, want: true},
+		{name: "fresh steering", timestamp: SteeringTimestampReceipt, elapsed: 100 * time.Millisecond, want: false},
+		{name: "old steering", timestamp: SteeringTimestampReceipt, elapsed: 300 * time.Millisecond, want: true},
+		{name: "fresh frame", timestamp: SteeringTimestampFrame, frameAge: durationPtr(100 * time.Millisecond), want: false},
+		{name: "old frame", timestamp: SteeringTimestampFrame, frameAge: durationPtr(300 * time.Millisecond), want: true},
+		{name: "old frame with receipt timestamp", timestamp: SteeringTimestampReceipt, frameAge: durationPtr(300 * time.Millisecond), want: false},
+		{name: "frame in the future", timestamp: SteeringTimestampFrame, frameAge: durationPtr(-time.Hour), elapsed: 300 * time.Millisecond, want: true},
+		{name: "frame timestamp without frame", timestamp: SteeringTimestampFrame, elapsed: 100 * time.Millisecond, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			w := steeringWatchdog{timeout: 200 * time.Millisecond, timestamp: tt.timestamp,
+				failsafe: &Failsafe{Mode: FailsafeNeutral}, clock: func() time.Time { return now }}
+
+			if !tt.noSignal {
+				msg := events.SteeringMessage{Steering: 0.1}
+				if tt.frameAge != nil {
+					msg.FrameRef = &events.FrameRef{CreatedAt: timestamppb.New(now.Add(-*tt.frameAge))}
+				}
+				w.Feed(&msg)
+			}
+			now = now.Add(tt.elapsed)
+			if got, _ := w.Expired(); got != tt.want {
+				t.Errorf("Expired() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func durationPtr(d time.Duration) *time.Duration {
+	return &d
+}
+
+func TestNewFailsafe(t *testing.T) {
+	tests := []struct {
+		name    string
+		mode    string
+		value   types.Throttle
+		want    types.Throttle
+		wantErr bool
+	}{
+		{name: "neutral", mode: "neutral", value: 0.3, want: 0.},
+		{name: "brake", mode: "brake", value: -0.3, want: -0.3},
+		{name: "positive brake", mode: "brake", value: 0.3, wantErr: true},
+		{name: "crawl", mode: "crawl", value: 0.15, want: 0.15},
+		{name: "negative crawl", mode: "crawl", value: -0.15, wantErr: true},
+		{name: "unknown mode", mode: "stop", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewFailsafe(tt.mode, tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewFailsafe() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			if got.Throttle != tt.want {
+				t.Errorf("NewFailsafe() throttle = %v, want %v", got.Throttle, tt.want)
+			}
+		})
+	}
+}